@@ -0,0 +1,170 @@
+package sqlist
+
+import (
+	"database/sql"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// AggFunc агрегат над отфильтрованными строками, см. Min, Max, Sum, Avg, Count
+type AggFunc struct {
+	Func  string // MIN, MAX, SUM, AVG, COUNT
+	Field string // алиас поля или колонка, пусто для COUNT(*)
+}
+
+// Min минимальное значение поля
+func Min(field string) AggFunc { return AggFunc{Func: "MIN", Field: field} }
+
+// Max максимальное значение поля
+func Max(field string) AggFunc { return AggFunc{Func: "MAX", Field: field} }
+
+// Sum сумма значений поля
+func Sum(field string) AggFunc { return AggFunc{Func: "SUM", Field: field} }
+
+// Avg среднее значение поля
+func Avg(field string) AggFunc { return AggFunc{Func: "AVG", Field: field} }
+
+// Count количество строк
+func Count() AggFunc { return AggFunc{Func: "COUNT"} }
+
+// AggregateQuery запрос агрегатов. Колонки результата - алиасы Aliases в том же порядке
+type AggregateQuery struct {
+	Aliases []string
+	SQL     string
+	Args    []any
+
+	funcs  map[string]AggFunc
+	values map[string]any
+}
+
+// Aggregates значения агрегатов по алиасам: COUNT - int64, SUM и AVG - float64,
+// MIN и MAX - значение колонки. Для пустой выборки значения, кроме COUNT, равны nil
+type Aggregates map[string]any
+
+// BuildAggregates строит один запрос агрегатов с теми же FROM, JOIN и WHERE, что и BuildSelect,
+// без сортировки и пагинации. Запрос независим от запроса страницы,
+// поэтому их можно отправить вместе (например, одним batch)
+func (b *SQLBuilder) BuildAggregates(aggregates map[string]AggFunc) (*AggregateQuery, error) {
+	if err := b.Err(); err != nil {
+		return nil, err
+	}
+	if err := b.requireUngrouped("BuildAggregates"); err != nil {
+		return nil, err
+	}
+	if len(aggregates) == 0 {
+		return nil, fmt.Errorf("sqlist: no aggregates")
+	}
+
+	aliases, columns, required, err := b.aggregateColumns(aggregates)
+	if err != nil {
+		return nil, err
+	}
+
+	selectBuilder, err := b.filteredSelect(columns, required)
+	if err != nil {
+		return nil, err
+	}
+
+	sql, args, err := selectBuilder.PlaceholderFormat(b.placeholder).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	return &AggregateQuery{Aliases: aliases, SQL: sql, Args: args, funcs: maps.Clone(aggregates)}, nil
+}
+
+// aggregateColumns строит колонки агрегатов в порядке алиасов
+// и собирает JOIN, нужные их полям
+func (b *SQLBuilder) aggregateColumns(aggregates map[string]AggFunc) ([]string, []string, map[string]bool, error) {
+	aliases := slices.Sorted(maps.Keys(aggregates))
+	columns := make([]string, 0, len(aliases))
+	required := b.requiredJoins(false, false)
+
+	for _, alias := range aliases {
+		agg := aggregates[alias]
+
+		column := "*"
+		if agg.Field != "" {
+			column = agg.Field
+			if cfg, ok := b.fieldConfigs[agg.Field]; ok {
+				if missing, ok := b.missingPermission(cfg.Permissions); ok {
+					return nil, nil, nil, &PermissionError{Field: agg.Field, Permission: missing}
+				}
+				column = cfg.DBField
+				for _, name := range cfg.Joins {
+					required[name] = true
+				}
+			}
+		}
+
+		switch {
+		case agg.Func == "COUNT":
+		case agg.Field == "":
+			return nil, nil, nil, fmt.Errorf("sqlist: aggregate %q has no field", alias)
+		case !slices.Contains([]string{"MIN", "MAX", "SUM", "AVG"}, agg.Func):
+			return nil, nil, nil, fmt.Errorf("sqlist: unknown aggregate function %q", agg.Func)
+		}
+
+		columns = append(columns, fmt.Sprintf("%s(%s) AS %s", agg.Func, column, alias))
+	}
+
+	return aliases, columns, required, nil
+}
+
+// Dest возвращает приемники для rows.Scan строки результата
+func (q *AggregateQuery) Dest() []any {
+	var dest []any
+	dest, q.values = aggregateDest(q.Aliases, q.funcs)
+	return dest
+}
+
+// Result возвращает значения, отсканированные в приемники Dest
+func (q *AggregateQuery) Result() Aggregates {
+	return aggregateResult(q.values)
+}
+
+// aggregateDest создает приемники значений агрегатов по их функциям
+func aggregateDest(aliases []string, funcs map[string]AggFunc) ([]any, map[string]any) {
+	values := make(map[string]any, len(aliases))
+
+	dest := make([]any, 0, len(aliases))
+	for _, alias := range aliases {
+		var target any
+		switch funcs[alias].Func {
+		case "COUNT":
+			target = new(int64)
+		case "SUM", "AVG":
+			target = new(sql.NullFloat64)
+		default:
+			target = new(any)
+		}
+		values[alias] = target
+		dest = append(dest, target)
+	}
+	return dest, values
+}
+
+// aggregateResult приводит отсканированные значения агрегатов к типам Aggregates
+func aggregateResult(values map[string]any) Aggregates {
+	result := make(Aggregates, len(values))
+	for alias, target := range values {
+		switch v := target.(type) {
+		case *int64:
+			result[alias] = *v
+		case *sql.NullFloat64:
+			if v.Valid {
+				result[alias] = v.Float64
+			} else {
+				result[alias] = nil
+			}
+		case *any:
+			if bytes, ok := (*v).([]byte); ok {
+				result[alias] = string(bytes)
+			} else {
+				result[alias] = *v
+			}
+		}
+	}
+	return result
+}
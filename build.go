@@ -1,36 +1,98 @@
 package sqlist
 
 import (
-	"fmt"
+	"maps"
+	"slices"
 
 	"github.com/Masterminds/squirrel"
 )
 
 // ============= МЕТОДЫ ПОСТРОЕНИЯ SQL =============
 
-// buildBaseSelect создает базовый селект
-func (b *SQLBuilder) buildBaseSelect() squirrel.SelectBuilder {
-	selectBuilder := squirrel.Select(b.fields...).From(b.fromTable)
+// buildBaseSelect создает базовый селект с выборкой, всеми нужными JOIN и группировкой
+func (b *SQLBuilder) buildBaseSelect() (squirrel.SelectBuilder, error) {
+	selectBuilder, err := b.filteredSelect(b.selectColumns(), b.requiredJoins(true, true))
+	if err != nil {
+		return selectBuilder, err
+	}
+	return b.withGroupBy(selectBuilder), nil
+}
+
+// filteredSelect создает селект с колонками columns: FROM, JOIN и WHERE.
+// Фильтры по полям excluded в WHERE не попадают
+func (b *SQLBuilder) filteredSelect(columns []string, required map[string]bool, excluded ...string) (squirrel.SelectBuilder, error) {
+	selectBuilder := squirrel.Select(columns...).From(b.fromTable)
+	if b.fromSubquery != nil {
+		from, err := b.fromSubquery.filteredQuery(b.Context())
+		if err != nil {
+			return selectBuilder, err
+		}
+		selectBuilder = selectBuilder.FromSelect(from, b.fromTable)
+	}
+
+	joins, err := b.resolveJoins(required)
+	if err != nil {
+		return selectBuilder, err
+	}
 
 	// Добавляем JOIN
-	for _, join := range b.joins {
-		selectBuilder = selectBuilder.JoinClause(
-			fmt.Sprintf("%s %s ON %s", join.Type, join.Table, join.Condition),
-		)
+	for _, join := range joins {
+		selectBuilder = selectBuilder.JoinClause(join)
 	}
 
 	// Добавляем WHERE условия!
-	if len(b.whereConditions) > 0 {
-		selectBuilder = selectBuilder.Where(squirrel.And(b.whereConditions))
+	conditions, err := b.conditions(excluded...)
+	if err != nil {
+		return selectBuilder, err
+	}
+	if len(conditions) > 0 {
+		selectBuilder = selectBuilder.Where(squirrel.And(conditions))
 	}
 
-	return selectBuilder
+	return selectBuilder, nil
 }
 
-// BuildCount строит запрос для подсчета
+// conditions возвращает все условия WHERE: обязательные ограничения, фильтры и пресеты по умолчанию.
+// Фильтры по полям excluded пропускаются
+func (b *SQLBuilder) conditions(excluded ...string) ([]squirrel.Sqlizer, error) {
+	conditions, err := b.scopeConditions()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, condition := range b.whereConditions {
+		if c, ok := condition.(fieldCondition); ok && slices.Contains(excluded, c.field) {
+			continue
+		}
+		if c, ok := condition.(inSubquery); ok {
+			c.ctx = b.Context()
+			condition = c
+		}
+		conditions = append(conditions, condition)
+	}
+	return append(conditions, b.defaultPresetConditions()...), nil
+}
+
+// BuildCount строит запрос для подсчета.
+// Подзапрос не содержит выборки и JOIN, нужных только выборке и сортировке.
+// Для сгруппированного списка считаются группы
 func (b *SQLBuilder) BuildCount() (string, []any, error) {
-	if len(b.whereConditions) > 0 || b.estimateTable == "" {
-		selectBuilder := b.buildBaseSelect()
+	if err := b.Err(); err != nil {
+		return "", nil, err
+	}
+
+	conditions, err := b.conditions()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(conditions) > 0 || b.estimateTable == "" || b.grouped() || b.fromSubquery != nil {
+		// в сгруппированном списке JOIN выборки могут участвовать в GROUP BY
+		selectBuilder, err := b.filteredSelect([]string{"1"}, b.requiredJoins(false, b.grouped()))
+		if err != nil {
+			return "", nil, err
+		}
+		selectBuilder = b.withGroupBy(selectBuilder)
 
 		countBuilder := squirrel.Select("COUNT(*)").FromSelect(selectBuilder, "subquery")
 
@@ -45,11 +107,42 @@ func (b *SQLBuilder) BuildCount() (string, []any, error) {
 
 // BuildSelect строит запрос для выборки данных
 func (b *SQLBuilder) BuildSelect() (string, []any, error) {
-	selectBuilder := b.buildBaseSelect()
+	if err := b.Err(); err != nil {
+		return "", nil, err
+	}
+
+	selectBuilder, err := b.pageSelect()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return selectBuilder.PlaceholderFormat(b.placeholder).ToSql()
+}
+
+// pageSelect создает селект страницы: выборка с сортировкой и пагинацией
+func (b *SQLBuilder) pageSelect() (squirrel.SelectBuilder, error) {
+	selectBuilder, err := b.buildBaseSelect()
+	if err != nil {
+		return selectBuilder, err
+	}
 
 	// Добавляем сортировку
-	if b.sort.Field != "" {
-		selectBuilder = selectBuilder.OrderBy(b.sort.Field + " " + b.sort.Order)
+	keys := b.sortKeys()
+	for _, key := range keys {
+		selectBuilder = selectBuilder.OrderByClause(key.expr+" "+key.order, key.args...)
+	}
+
+	// Курсорная пагинация: сравнение с агрегатом возможно только в HAVING
+	if b.cursor != nil {
+		condition, err := keysetCondition(keys, b.cursor)
+		if err != nil {
+			return selectBuilder, err
+		}
+		if slices.ContainsFunc(keys, func(key sortKey) bool { return key.aggregate }) {
+			selectBuilder = selectBuilder.Having(condition)
+		} else {
+			selectBuilder = selectBuilder.Where(condition)
+		}
 	}
 
 	// Добавляем пагинацию
@@ -60,30 +153,82 @@ func (b *SQLBuilder) BuildSelect() (string, []any, error) {
 		selectBuilder = selectBuilder.Offset(b.offset)
 	}
 
-	return selectBuilder.PlaceholderFormat(b.placeholder).ToSql()
+	return selectBuilder, nil
 }
 
 // Reset сбрасывает состояние
 func (b *SQLBuilder) Reset() *SQLBuilder {
 	b.whereConditions = []squirrel.Sqlizer{}
+	b.havingConditions = nil
 	b.sort = SortConfig{}
+	b.pin = nil
+	b.cursor = nil
+	b.requestedFields = nil
+	b.filterJoins = nil
+	b.relationFilters = nil
+	b.appliedPresets = nil
+	b.skippedPresets = nil
 	b.limit = 0
 	b.offset = 0
+	b.err = nil
 
 	return b
 }
 
-// Clone создает копию с чистым состоянием
+// Clone создает копию с той же конфигурацией и чистым состоянием.
+// Копия не разделяет с оригиналом изменяемых данных, вложенный билдер WithFromSubquery тоже копируется
 func (b *SQLBuilder) Clone() *SQLBuilder {
-	return &SQLBuilder{
+	c := &SQLBuilder{
 		fromTable:       b.fromTable,
 		estimateTable:   b.estimateTable,
 		fields:          append([]string{}, b.fields...),
+		selectFields:    maps.Clone(b.selectFields),
+		selectOrder:     append([]string{}, b.selectOrder...),
+		relations:       maps.Clone(b.relations),
+		sortFields:      maps.Clone(b.sortFields),
+		presets:         maps.Clone(b.presets),
+		presetOrder:     append([]string{}, b.presetOrder...),
+		presetParam:     b.presetParam,
+		scopes:          append([]scopeConfig{}, b.scopes...),
+		ctx:             b.ctx,
+		permissions:     append([]string{}, b.permissions...),
 		joins:           append([]joinConfig{}, b.joins...),
+		groupBy:         append([]string{}, b.groupBy...),
+		groupJoins:      append([]string{}, b.groupJoins...),
+		tieBreaker:      b.tieBreaker,
 		placeholder:     b.placeholder,
+		dialect:         b.dialect,
+		fieldConfigs:    maps.Clone(b.fieldConfigs),
+		fieldVariants:   cloneVariants(b.fieldVariants),
+		fieldConfigMode: b.fieldConfigMode,
+		duplicateFields: append([]string{}, b.duplicateFields...),
+		ops:             maps.Clone(b.ops),
+		configErr:       b.configErr,
+		clock:           b.clock,
+		location:        b.location,
+		nullToken:       b.nullToken,
+		notNullToken:    b.notNullToken,
+		maxLimit:        b.maxLimit,
 		whereConditions: []squirrel.Sqlizer{},
 		sort:            SortConfig{},
 		limit:           0,
 		offset:          0,
 	}
+	if b.fromSubquery != nil {
+		c.fromSubquery = b.fromSubquery.snapshot()
+	}
+	return c
+}
+
+// cloneVariants копирует дополнительные операторы полей вместе со срезами
+func cloneVariants(variants map[string][]FieldConfig) map[string][]FieldConfig {
+	if variants == nil {
+		return nil
+	}
+
+	result := make(map[string][]FieldConfig, len(variants))
+	for field, configs := range variants {
+		result[field] = append([]FieldConfig{}, configs...)
+	}
+	return result
 }
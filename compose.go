@@ -0,0 +1,126 @@
+package sqlist
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// ToSql строит запрос страницы как BuildSelect, но с плейсхолдерами "?".
+// Так билдер можно передать как squirrel.Sqlizer во внешний запрос: плейсхолдеры
+// пронумерует внешний запрос своим форматом
+func (b *SQLBuilder) ToSql() (string, []interface{}, error) {
+	if err := b.Err(); err != nil {
+		return "", nil, err
+	}
+
+	selectBuilder, err := b.pageSelect()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return selectBuilder.PlaceholderFormat(sq.Question).ToSql()
+}
+
+// WithFromSubquery использует отфильтрованную выборку builder как источник FROM: (SELECT ...) AS alias.
+// Во вложенный запрос попадают выборка, JOIN, фильтры и группировка builder, без сортировки и пагинации.
+// Билдер строится при каждом построении внешнего запроса с контекстом внешнего билдера,
+// поэтому после передачи его не стоит менять. Clone копирует вложенный билдер
+func (b *SQLBuilder) WithFromSubquery(builder *SQLBuilder, alias string) *SQLBuilder {
+	b.fromTable = alias
+	b.fromSubquery = builder
+	return b
+}
+
+// InSubquery добавляет условие field IN (SELECT ...) по отфильтрованной выборке builder
+// без сортировки и пагинации. Выборка builder должна состоять из одной колонки.
+// Обязательные ограничения builder берут значения из контекста внешнего билдера
+func (b *SQLBuilder) InSubquery(field string, builder *SQLBuilder) *SQLBuilder {
+	if builder != nil {
+		b.whereConditions = append(b.whereConditions, inSubquery{column: b.mapField(field), builder: builder.snapshot()})
+	}
+	return b
+}
+
+// filteredQuery создает отфильтрованную выборку билдера для вложенного запроса.
+// Билдер строится с контекстом ctx внешнего запроса, а не со своим
+func (b *SQLBuilder) filteredQuery(ctx context.Context) (sq.SelectBuilder, error) {
+	nested := b.snapshot()
+	nested.ctx = ctx
+	if err := nested.Err(); err != nil {
+		return sq.SelectBuilder{}, err
+	}
+	selectBuilder, err := nested.buildBaseSelect()
+	return selectBuilder.PlaceholderFormat(sq.Question), err
+}
+
+// snapshot копирует билдер вместе с состоянием запроса: фильтрами, сортировкой и пагинацией
+func (b *SQLBuilder) snapshot() *SQLBuilder {
+	c := b.Clone()
+
+	filters := make(map[*relationFilter]*relationFilter)
+	copyFilter := func(filter *relationFilter) *relationFilter {
+		if copied, ok := filters[filter]; ok {
+			return copied
+		}
+		copied := *filter
+		copied.conditions = slices.Clone(filter.conditions)
+		copied.counts = slices.Clone(filter.counts)
+		filters[filter] = &copied
+		return &copied
+	}
+
+	for _, condition := range b.whereConditions {
+		switch condition := condition.(type) {
+		case *relationFilter:
+			c.whereConditions = append(c.whereConditions, copyFilter(condition))
+		case inSubquery:
+			condition.builder = condition.builder.snapshot()
+			c.whereConditions = append(c.whereConditions, condition)
+		default:
+			c.whereConditions = append(c.whereConditions, condition)
+		}
+	}
+	for name, filter := range b.relationFilters {
+		if c.relationFilters == nil {
+			c.relationFilters = make(map[string]*relationFilter, len(b.relationFilters))
+		}
+		c.relationFilters[name] = copyFilter(filter)
+	}
+
+	c.havingConditions = slices.Clone(b.havingConditions)
+	c.sort = b.sort
+	c.pin = b.pin
+	c.cursor = maps.Clone(b.cursor)
+	c.requestedFields = slices.Clone(b.requestedFields)
+	c.filterJoins = maps.Clone(b.filterJoins)
+	c.appliedPresets = slices.Clone(b.appliedPresets)
+	c.skippedPresets = slices.Clone(b.skippedPresets)
+	c.limit = b.limit
+	c.offset = b.offset
+	c.err = b.err
+	return c
+}
+
+// inSubquery условие IN по вложенному билдеру.
+// Контекст внешнего билдера подставляется при построении его условий, см. conditions
+type inSubquery struct {
+	column  string
+	builder *SQLBuilder
+	ctx     context.Context
+}
+
+func (c inSubquery) ToSql() (string, []interface{}, error) {
+	selectBuilder, err := c.builder.filteredQuery(c.ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	sql, args, err := selectBuilder.ToSql()
+	if err != nil {
+		return "", nil, err
+	}
+	return c.column + " IN (" + sql + ")", args, nil
+}
@@ -0,0 +1,170 @@
+package sqlist
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// relativeExpr выражение относительно текущего момента: now, now-7d, now-1M+2h.
+// Единицы: s, m (минуты), h, d, w, M (месяцы), y
+var relativeExpr = regexp.MustCompile(`^now((?:[+-]\d+[smhdwMy])*)$`)
+
+var relativeOffset = regexp.MustCompile(`([+-]\d+)([smhdwMy])`)
+
+// timeValue разобранное значение даты: момент времени (start == end)
+// или полуинтервал [start, end) для дат без времени и периодов (today, this_month)
+type timeValue struct {
+	start, end time.Time
+}
+
+func (v timeValue) isPoint() bool {
+	return v.start.Equal(v.end)
+}
+
+// WithClock устанавливает источник текущего времени для относительных дат (now, today, ...)
+func (b *SQLBuilder) WithClock(clock func() time.Time) *SQLBuilder {
+	b.clock = clock
+	return b
+}
+
+// WithLocation устанавливает часовой пояс пользователя, в котором трактуются даты и периоды
+func (b *SQLBuilder) WithLocation(location *time.Location) *SQLBuilder {
+	b.location = location
+	return b
+}
+
+// now возвращает текущее время в часовом поясе пользователя
+func (b *SQLBuilder) now() time.Time {
+	now := time.Now
+	if b.clock != nil {
+		now = b.clock
+	}
+	return now().In(b.loc())
+}
+
+func (b *SQLBuilder) loc() *time.Location {
+	if b.location == nil {
+		return time.UTC
+	}
+	return b.location
+}
+
+// parseTime разбирает абсолютную или относительную дату:
+// now, now-7d, today, yesterday, tomorrow, this_week, last_week, this_month,
+// last_month, this_year, last_year, 2024-01-01, 2024-01-01T10:00:00Z
+func (b *SQLBuilder) parseTime(value string) (timeValue, error) {
+	now := b.now()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	// неделя начинается с понедельника
+	week := day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	year := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, now.Location())
+
+	switch value {
+	case "today":
+		return timeValue{day, day.AddDate(0, 0, 1)}, nil
+	case "yesterday":
+		return timeValue{day.AddDate(0, 0, -1), day}, nil
+	case "tomorrow":
+		return timeValue{day.AddDate(0, 0, 1), day.AddDate(0, 0, 2)}, nil
+	case "this_week":
+		return timeValue{week, week.AddDate(0, 0, 7)}, nil
+	case "last_week":
+		return timeValue{week.AddDate(0, 0, -7), week}, nil
+	case "this_month":
+		return timeValue{month, month.AddDate(0, 1, 0)}, nil
+	case "last_month":
+		return timeValue{month.AddDate(0, -1, 0), month}, nil
+	case "this_year":
+		return timeValue{year, year.AddDate(1, 0, 0)}, nil
+	case "last_year":
+		return timeValue{year.AddDate(-1, 0, 0), year}, nil
+	}
+
+	if match := relativeExpr.FindStringSubmatch(value); match != nil {
+		t := now
+		for _, offset := range relativeOffset.FindAllStringSubmatch(match[1], -1) {
+			n, err := strconv.Atoi(offset[1])
+			if err != nil {
+				return timeValue{}, fmt.Errorf("sqlist: invalid time offset %q: %w", value, err)
+			}
+			t = shiftTime(t, n, offset[2])
+		}
+		return timeValue{t, t}, nil
+	}
+
+	// дата без времени означает весь день
+	if d, err := time.ParseInLocation(time.DateOnly, value, b.loc()); err == nil {
+		return timeValue{d, d.AddDate(0, 0, 1)}, nil
+	}
+
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, b.loc()); err == nil {
+			return timeValue{t, t}, nil
+		}
+	}
+
+	return timeValue{}, fmt.Errorf("sqlist: invalid time value %q", value)
+}
+
+// shiftTime сдвигает время на n единиц
+func shiftTime(t time.Time, n int, unit string) time.Time {
+	switch unit {
+	case "s":
+		return t.Add(time.Duration(n) * time.Second)
+	case "m":
+		return t.Add(time.Duration(n) * time.Minute)
+	case "h":
+		return t.Add(time.Duration(n) * time.Hour)
+	case "d":
+		return t.AddDate(0, 0, n)
+	case "w":
+		return t.AddDate(0, 0, 7*n)
+	case "M":
+		return t.AddDate(0, n, 0)
+	default: // "y"
+		return t.AddDate(n, 0, 0)
+	}
+}
+
+// timeCondition строит условие сравнения колонки с датой.
+// Для интервала (день, период) границы раскрываются: "= today" превращается
+// в ">= начало AND < конец", "<= 2024-01-31" в "< 2024-02-01" и т.д.
+func timeCondition(column string, op Op, v timeValue) sq.Sqlizer {
+	if v.isPoint() {
+		switch op {
+		case EQ:
+			return sq.Eq{column: v.start}
+		case NOT_EQ:
+			return sq.NotEq{column: v.start}
+		case GT:
+			return sq.Gt{column: v.start}
+		case GTE:
+			return sq.GtOrEq{column: v.start}
+		case LT:
+			return sq.Lt{column: v.start}
+		default: // LTE
+			return sq.LtOrEq{column: v.start}
+		}
+	}
+
+	switch op {
+	case EQ:
+		return sq.And{sq.GtOrEq{column: v.start}, sq.Lt{column: v.end}}
+	case NOT_EQ:
+		return sq.Or{sq.Lt{column: v.start}, sq.GtOrEq{column: v.end}}
+	case GT:
+		return sq.GtOrEq{column: v.end}
+	case GTE:
+		return sq.GtOrEq{column: v.start}
+	case LT:
+		return sq.Lt{column: v.start}
+	default: // LTE
+		return sq.Lt{column: v.end}
+	}
+}
@@ -0,0 +1,38 @@
+package sqlist
+
+// ListDefinition неизменяемое описание списочного вывода: таблицы, поля, JOIN,
+// настройки полей, диалект и лимиты. Создается один раз (например, при старте),
+// безопасно используется из нескольких горутин и порождает билдеры для запросов
+type ListDefinition struct {
+	template *SQLBuilder
+	limit    uint64 // лимит по умолчанию для нового запроса
+}
+
+// NewListDefinition фиксирует конфигурацию билдера. Билдер копируется, поэтому его
+// дальнейшие изменения не влияют на описание. Возвращает ошибку, если конфигурация
+// не проходит Validate. Контекст билдера в описание не попадает: он принадлежит
+// одному запросу и передается через NewRequestWithContext
+func NewListDefinition(b *SQLBuilder) (*ListDefinition, error) {
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	if err := b.Err(); err != nil {
+		return nil, err
+	}
+
+	template := b.Clone()
+	template.ctx = nil
+
+	return &ListDefinition{
+		template: template,
+		limit:    b.limit,
+	}, nil
+}
+
+// NewRequest возвращает билдер для одного запроса. Изменения билдера
+// (фильтры, сортировка, Reset, даже новые настройки полей) не затрагивают описание
+func (d *ListDefinition) NewRequest() *SQLBuilder {
+	b := d.template.Clone()
+	b.limit = d.limit
+	return b
+}
@@ -0,0 +1,40 @@
+package sqlist
+
+import (
+	sq "github.com/Masterminds/squirrel"
+)
+
+// Dialect определяет диалект SQL, под который строятся запросы.
+// От диалекта зависят операторы, у которых нет общего синтаксиса (массивы и т.п.)
+type Dialect string
+
+const (
+	// PostgreSQL диалект по умолчанию. Массивы передаются одним параметром - Go-срезом
+	// ([]string, []int64, ...) без приведения типа в SQL. Срезы как массивы кодирует pgx;
+	// с lib/pq значения для методов ArrayContains и т.п. нужно оборачивать в pq.Array,
+	// а для ApplyFilter переопределить операторы массивов через WithOp
+	PostgreSQL Dialect = "postgres"
+
+	// MySQL не имеет массивов: колонки-"массивы" хранятся как JSON,
+	// операторы над ними транслируются в JSON_CONTAINS/JSON_OVERLAPS (MySQL 8.0.17+)
+	MySQL Dialect = "mysql"
+
+	// SQLite не поддерживает операторы над массивами
+	SQLite Dialect = "sqlite"
+)
+
+// placeholder возвращает формат плейсхолдеров, принятый в диалекте
+func (d Dialect) placeholder() sq.PlaceholderFormat {
+	if d == PostgreSQL {
+		return sq.Dollar
+	}
+	return sq.Question
+}
+
+// WithDialect устанавливает диалект и соответствующий ему формат плейсхолдеров.
+// Формат можно переопределить последующим вызовом WithPlaceholder
+func (b *SQLBuilder) WithDialect(dialect Dialect) *SQLBuilder {
+	b.dialect = dialect
+	b.placeholder = dialect.placeholder()
+	return b
+}
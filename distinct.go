@@ -0,0 +1,90 @@
+package sqlist
+
+import (
+	"fmt"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// DistinctOrder порядок значений в BuildDistinct
+type DistinctOrder int
+
+const (
+	// DistinctByFrequency сначала самые частые значения (по умолчанию)
+	DistinctByFrequency DistinctOrder = iota
+
+	// DistinctAlphabetical значения по возрастанию
+	DistinctAlphabetical
+)
+
+// likeEscaper экранирует спецсимволы LIKE в начале значения
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// BuildDistinct строит запрос различных значений поля для выпадающих списков фильтров:
+// значения, начинающиеся с prefix (без учета регистра), не больше limit штук.
+// Учитываются обязательные ограничения и активные фильтры, кроме фильтра по самому полю.
+// Колонки результата: value и count
+func (b *SQLBuilder) BuildDistinct(field, prefix string, limit uint64, order ...DistinctOrder) (string, []any, error) {
+	if err := b.Err(); err != nil {
+		return "", nil, err
+	}
+	if err := b.requireUngrouped("BuildDistinct"); err != nil {
+		return "", nil, err
+	}
+
+	cfg, ok := b.fieldConfigs[field]
+	switch {
+	case !ok:
+		return "", nil, fmt.Errorf("sqlist: unknown field %q", field)
+	case cfg.Relation != "":
+		return "", nil, fmt.Errorf("sqlist: field %q refers to relation %q", field, cfg.Relation)
+	}
+
+	if missing, ok := b.missingPermission(cfg.Permissions); ok {
+		return "", nil, &PermissionError{Field: field, Permission: missing}
+	}
+
+	selectBuilder, err := b.filteredSelect(
+		[]string{cfg.DBField + " AS value", "COUNT(*) AS count"},
+		b.facetJoins(field),
+		field,
+	)
+	if err != nil {
+		return "", nil, err
+	}
+
+	selectBuilder = selectBuilder.Where(sq.NotEq{cfg.DBField: nil})
+	if prefix != "" {
+		selectBuilder = selectBuilder.Where(prefixCondition(b.dialect, cfg.DBField, prefix))
+	}
+
+	selectBuilder = selectBuilder.GroupBy(cfg.DBField)
+	if len(order) > 0 && order[0] == DistinctAlphabetical {
+		selectBuilder = selectBuilder.OrderBy("value")
+	} else {
+		selectBuilder = selectBuilder.OrderBy("count DESC", "value")
+	}
+
+	if limit = b.clampLimit(limit); limit > 0 {
+		selectBuilder = selectBuilder.Limit(limit)
+	}
+
+	return selectBuilder.PlaceholderFormat(b.placeholder).ToSql()
+}
+
+// prefixCondition строит условие "значение начинается с prefix" без учета регистра
+func prefixCondition(dialect Dialect, column, prefix string) sq.Sqlizer {
+	pattern := likeEscaper.Replace(prefix) + "%"
+
+	switch dialect {
+	case PostgreSQL:
+		return sq.ILike{column: pattern}
+	case SQLite:
+		// в SQLite у LIKE нет символа экранирования по умолчанию
+		return sq.Expr(column+` LIKE ? ESCAPE '\'`, pattern)
+	}
+
+	// в MySQL LIKE не учитывает регистр при обычных collation
+	return sq.Like{column: pattern}
+}
@@ -0,0 +1,36 @@
+package sqlist
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnsupported возвращается, если оператор не поддерживается выбранным диалектом
+var ErrUnsupported = errors.New("sqlist: unsupported by dialect")
+
+// Err возвращает ошибку, накопленную при конфигурации и построении условий
+func (b *SQLBuilder) Err() error {
+	if b.configErr == nil {
+		return b.err
+	}
+	return errors.Join(b.configErr, b.err)
+}
+
+// addConfigError сохраняет ошибку конфигурации. В отличие от ошибок фильтров она не сбрасывается Reset
+func (b *SQLBuilder) addConfigError(err error) {
+	if err != nil {
+		b.configErr = errors.Join(b.configErr, err)
+	}
+}
+
+// addError сохраняет ошибку для последующего возврата из build-методов
+func (b *SQLBuilder) addError(err error) {
+	if err != nil {
+		b.err = errors.Join(b.err, err)
+	}
+}
+
+// unsupported формирует ошибку о неподдерживаемом диалектом операторе
+func unsupported(op Op, dialect Dialect) error {
+	return fmt.Errorf("%w: operator %q, dialect %q", ErrUnsupported, op, dialect)
+}
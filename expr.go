@@ -0,0 +1,121 @@
+package sqlist
+
+import (
+	"fmt"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// exprOperators SQL-операторы для выражений EXPR_*
+var exprOperators = map[Op]string{
+	EXPR_EQ:     "=",
+	EXPR_NOT_EQ: "<>",
+	EXPR_GT:     ">",
+	EXPR_LT:     "<",
+	EXPR_GTE:    ">=",
+	EXPR_LTE:    "<=",
+	EXPR_LIKE:   "LIKE",
+	EXPR_ILIKE:  "ILIKE",
+	EXPR_IN:     "IN",
+}
+
+// exprOps соответствие обычных операторов выражениям,
+// по нему ApplyExpr обрабатывает поля с обычным оператором
+var exprOps = map[Op]Op{
+	EQ:     EXPR_EQ,
+	NOT_EQ: EXPR_NOT_EQ,
+	GT:     EXPR_GT,
+	LT:     EXPR_LT,
+	GTE:    EXPR_GTE,
+	LTE:    EXPR_LTE,
+	LIKE:   EXPR_LIKE,
+	ILIKE:  EXPR_ILIKE,
+	IN:     EXPR_IN,
+}
+
+// ValueExpr задает шаблон правой части для операторов EXPR_*, "?" заменяется значением фильтра.
+// Пример: ValueExpr("persons.snils2bcd64(?)")
+func ValueExpr(template string) FieldOption {
+	return func(cfg *FieldConfig) {
+		cfg.ValueExpr = template
+	}
+}
+
+// ExprArgs задает аргументы для плейсхолдеров в выражении DBField
+func ExprArgs(args ...interface{}) FieldOption {
+	return func(cfg *FieldConfig) {
+		cfg.ExprArgs = args
+	}
+}
+
+// ExprOp добавляет условие сравнения двух выражений оператором EXPR_*.
+// Для EXPR_IN правая часть оборачивается в скобки: left IN (right)
+// Пример: ExprOp("lower(email)", EXPR_LIKE, "lower(?)", "john%")
+func (b *SQLBuilder) ExprOp(leftExpr string, op Op, rightExpr string, args ...interface{}) *SQLBuilder {
+	condition, err := exprCondition(leftExpr, op, rightExpr, args...)
+	if err != nil {
+		b.addError(err)
+		return b
+	}
+
+	b.whereConditions = append(b.whereConditions, condition)
+	return b
+}
+
+// exprCondition строит условие "left op right" для оператора EXPR_*
+func exprCondition(leftExpr string, op Op, rightExpr string, args ...interface{}) (sq.Sqlizer, error) {
+	operator, ok := exprOperators[op]
+	if !ok {
+		return nil, fmt.Errorf("sqlist: operator %q is not an expression operator", op)
+	}
+
+	if op == EXPR_IN {
+		rightExpr = "(" + rightExpr + ")"
+	}
+
+	return sq.Expr(leftExpr+" "+operator+" "+rightExpr, args...), nil
+}
+
+// placeholderCount считает плейсхолдеры "?" в выражении, "??" - экранированный знак вопроса
+func placeholderCount(expr string) int {
+	return strings.Count(strings.ReplaceAll(expr, "??", ""), "?")
+}
+
+// exprOp оператор EXPR_* для ApplyFilter: значения подставляются в шаблон ValueExpr
+func exprOp(op Op) OpEnvFunc {
+	return func(env OpEnv, column string, values []string, cfg FieldConfig) (sq.Sqlizer, error) {
+		template := cfg.ValueExpr
+		if template == "" {
+			template = "?"
+		}
+		if strings.Count(template, "?") != 1 {
+			return nil, fmt.Errorf("value expression %q must contain exactly one placeholder", template)
+		}
+
+		if op != EXPR_IN {
+			values = values[:1]
+		} else if values = splitValues(values); len(values) == 0 {
+			return nil, nil
+		}
+
+		args := append([]interface{}{}, cfg.ExprArgs...)
+		templates := make([]string, 0, len(values))
+		for _, value := range values {
+			parsed, err := env.ParseValue(cfg, value)
+			if err != nil {
+				return nil, err
+			}
+			switch op {
+			case EXPR_LIKE:
+				parsed = value + "%"
+			case EXPR_ILIKE:
+				parsed = "%" + value + "%"
+			}
+			args = append(args, parsed)
+			templates = append(templates, template)
+		}
+
+		return exprCondition(column, op, strings.Join(templates, ", "), args...)
+	}
+}
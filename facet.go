@@ -0,0 +1,200 @@
+package sqlist
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// FacetQuery запрос количества строк по значениям одного или нескольких фасетов.
+// Колонки результата: значения Fields, для нескольких фасетов - маска GROUPING, затем количество
+type FacetQuery struct {
+	Fields []string // алиасы фасетов, посчитанных запросом
+	SQL    string
+	Args   []any
+
+	values   []any
+	grouping int64
+	count    int64
+}
+
+// FacetCount количество строк с одним значением фасета
+type FacetCount struct {
+	Value any
+	Count int64
+}
+
+// Facets результат фасетного подсчета: алиас фасета -> значения с количеством
+type Facets map[string][]FacetCount
+
+// BuildFacets строит запросы количества строк по значениям полей fields с теми же FROM, JOIN и WHERE.
+// Для каждого фасета не учитывается его собственный фильтр, чтобы в списке оставались
+// альтернативные значения. Фасеты без активного фильтра на PostgreSQL считаются одним
+// запросом с GROUPING SETS, остальные - отдельными запросами с GROUP BY
+func (b *SQLBuilder) BuildFacets(fields ...string) ([]*FacetQuery, error) {
+	if err := b.Err(); err != nil {
+		return nil, err
+	}
+	if err := b.requireUngrouped("BuildFacets"); err != nil {
+		return nil, err
+	}
+
+	var shared, own []string
+	for _, field := range fields {
+		cfg, ok := b.fieldConfigs[field]
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("sqlist: unknown facet %q", field)
+		case cfg.Relation != "":
+			return nil, fmt.Errorf("sqlist: facet %q refers to relation %q", field, cfg.Relation)
+		}
+
+		if missing, ok := b.missingPermission(cfg.Permissions); ok {
+			return nil, &PermissionError{Field: field, Permission: missing}
+		}
+
+		if b.filtered(field) {
+			own = append(own, field)
+		} else {
+			shared = append(shared, field)
+		}
+	}
+
+	var queries []*FacetQuery
+
+	if len(shared) > 1 && b.dialect == PostgreSQL {
+		query, err := b.groupingSetsFacets(shared)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, query)
+		shared = nil
+	}
+
+	for _, field := range fields {
+		if !slices.Contains(shared, field) && !slices.Contains(own, field) {
+			continue
+		}
+
+		query, err := b.facet(field)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, query)
+	}
+
+	return queries, nil
+}
+
+// facet строит запрос по одному фасету без его собственного фильтра
+func (b *SQLBuilder) facet(field string) (*FacetQuery, error) {
+	cfg := b.fieldConfigs[field]
+
+	selectBuilder, err := b.filteredSelect(
+		[]string{cfg.DBField + " AS " + field, "COUNT(*) AS count"},
+		b.facetJoins(field),
+		field,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	sql, args, err := selectBuilder.
+		GroupBy(cfg.DBField).
+		OrderBy("count DESC", field).
+		PlaceholderFormat(b.placeholder).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	return &FacetQuery{Fields: []string{field}, SQL: sql, Args: args}, nil
+}
+
+// groupingSetsFacets строит один запрос по фасетам без активных фильтров
+func (b *SQLBuilder) groupingSetsFacets(fields []string) (*FacetQuery, error) {
+	columns := make([]string, 0, len(fields)+2)
+	expressions := make([]string, 0, len(fields))
+	sets := make([]string, 0, len(fields))
+	required := b.requiredJoins(false, false)
+
+	for _, field := range fields {
+		cfg := b.fieldConfigs[field]
+		columns = append(columns, cfg.DBField+" AS "+field)
+		expressions = append(expressions, cfg.DBField)
+		sets = append(sets, "("+cfg.DBField+")")
+		for _, name := range cfg.Joins {
+			required[name] = true
+		}
+	}
+	columns = append(columns,
+		"GROUPING("+strings.Join(expressions, ", ")+") AS facet_grouping",
+		"COUNT(*) AS count",
+	)
+
+	selectBuilder, err := b.filteredSelect(columns, required)
+	if err != nil {
+		return nil, err
+	}
+
+	sql, args, err := selectBuilder.
+		GroupBy("GROUPING SETS (" + strings.Join(sets, ", ") + ")").
+		OrderBy("count DESC").
+		PlaceholderFormat(b.placeholder).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	return &FacetQuery{Fields: fields, SQL: sql, Args: args}, nil
+}
+
+// facetJoins возвращает JOIN для фасета: нужные фильтрам и самому полю фасета
+func (b *SQLBuilder) facetJoins(field string) map[string]bool {
+	required := b.requiredJoins(false, false)
+	for _, name := range b.fieldConfigs[field].Joins {
+		required[name] = true
+	}
+	return required
+}
+
+// filtered проверяет, есть ли активный фильтр по полю
+func (b *SQLBuilder) filtered(field string) bool {
+	return slices.ContainsFunc(b.whereConditions, func(condition sq.Sqlizer) bool {
+		c, ok := condition.(fieldCondition)
+		return ok && c.field == field
+	})
+}
+
+// Dest возвращает приемники для rows.Scan строки результата запроса
+func (q *FacetQuery) Dest() []any {
+	q.values = make([]any, len(q.Fields))
+	q.grouping, q.count = 0, 0
+
+	dest := make([]any, 0, len(q.Fields)+2)
+	for i := range q.values {
+		dest = append(dest, &q.values[i])
+	}
+	if len(q.Fields) > 1 {
+		dest = append(dest, &q.grouping)
+	}
+	return append(dest, &q.count)
+}
+
+// Collect добавляет в facets строку, отсканированную в приемники Dest
+func (q *FacetQuery) Collect(facets Facets) {
+	for i, field := range q.Fields {
+		// бит фасета в маске GROUPING равен 0, если строка сгруппирована по нему
+		if len(q.Fields) > 1 && q.grouping&(1<<(len(q.Fields)-1-i)) != 0 {
+			continue
+		}
+
+		value := q.values[i]
+		if bytes, ok := value.([]byte); ok {
+			value = string(bytes)
+		}
+		facets[field] = append(facets[field], FacetCount{Value: value, Count: q.count})
+	}
+}
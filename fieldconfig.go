@@ -0,0 +1,234 @@
+package sqlist
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// FieldConfigMode определяет, как WithFieldConfig обрабатывает повторную настройку поля
+type FieldConfigMode int
+
+const (
+	// FieldConfigStrict повторная настройка поля - ошибка (по умолчанию)
+	FieldConfigStrict FieldConfigMode = iota
+
+	// FieldConfigMulti поле может иметь несколько операторов, оператор выбирается
+	// модификатором в имени фильтра: "price[gte]", "price[lte]". Без модификатора
+	// используется первая настройка
+	FieldConfigMulti
+)
+
+// qualifiedColumn колонка с квалификатором: u.name, public.users.id.
+// Вызовы функций со схемой (persons.snils2bcd64(...)) отбрасываются по скобке
+var qualifiedColumn = regexp.MustCompile(`([A-Za-z_]\w*(?:\.[A-Za-z_]\w*)*)\.[A-Za-z_]\w*(\s*\()?`)
+
+// stringLiteral строковый литерал SQL, кавычка внутри литерала удваивается
+var stringLiteral = regexp.MustCompile(`'(?:[^']|'')*'`)
+
+// innerSource таблица, объявленная внутри выражения: "FROM orders o", "JOIN public.items AS i"
+var innerSource = regexp.MustCompile(`(?i)\b(?:FROM|JOIN)\s+([A-Za-z_][\w.]*)(?:\s+(?:AS\s+)?([A-Za-z_]\w*))?`)
+
+// WithFieldConfigMode устанавливает режим повторной настройки полей
+func (b *SQLBuilder) WithFieldConfigMode(mode FieldConfigMode) *SQLBuilder {
+	b.fieldConfigMode = mode
+	return b
+}
+
+// OverrideFieldConfig явно заменяет настройку поля вместе со всеми его дополнительными операторами
+func (b *SQLBuilder) OverrideFieldConfig(field string, dbField string, op Op, opts ...FieldOption) *SQLBuilder {
+	if b.fieldConfigs == nil {
+		b.fieldConfigs = make(map[string]FieldConfig)
+	}
+
+	b.fieldConfigs[field] = newFieldConfig(dbField, op, opts)
+	delete(b.fieldVariants, field)
+
+	return b
+}
+
+// newFieldConfig создает настройку поля с опциями
+func newFieldConfig(dbField string, op Op, opts []FieldOption) FieldConfig {
+	cfg := FieldConfig{
+		DBField:  dbField,
+		Operator: op,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// hasFieldVariant проверяет, настроен ли для поля дополнительный оператор op
+func (b *SQLBuilder) hasFieldVariant(field string, op Op) bool {
+	return slices.ContainsFunc(b.fieldVariants[field], func(cfg FieldConfig) bool {
+		return cfg.Operator == op
+	})
+}
+
+// fieldConfig возвращает настройку поля с оператором op, для пустого op - основную
+func (b *SQLBuilder) fieldConfig(field string, op Op) (FieldConfig, bool) {
+	cfg, ok := b.fieldConfigs[field]
+	if !ok || op == "" || cfg.Operator == op {
+		return cfg, ok
+	}
+
+	for _, variant := range b.fieldVariants[field] {
+		if variant.Operator == op {
+			return variant, true
+		}
+	}
+
+	return FieldConfig{}, false
+}
+
+// Validate проверяет конфигурацию полей: повторные настройки, пустые DBField,
+// незарегистрированные операторы, ссылки на неизвестные JOIN
+// и колонки таблиц, отсутствующих во FROM и JOIN
+func (b *SQLBuilder) Validate() error {
+	var errs []error
+
+	for _, field := range b.duplicateFields {
+		errs = append(errs, fmt.Errorf("sqlist: field %q is configured more than once", field))
+	}
+
+	sources := b.sources()
+
+	joins := make(map[string]bool)
+	for _, join := range b.joins {
+		if join.Name != "" {
+			joins[join.Name] = true
+		}
+	}
+	for _, join := range b.joins {
+		for _, dependency := range join.DependsOn {
+			if !joins[dependency] {
+				errs = append(errs, fmt.Errorf("sqlist: join %q depends on unknown join %q", join.Name, dependency))
+			}
+		}
+	}
+	for _, alias := range b.selectOrder {
+		for _, name := range b.selectFields[alias].Joins {
+			if !joins[name] {
+				errs = append(errs, fmt.Errorf("sqlist: select field %q requires unknown join %q", alias, name))
+			}
+		}
+	}
+
+	for _, name := range b.groupJoins {
+		if !joins[name] {
+			errs = append(errs, fmt.Errorf("sqlist: group by requires unknown join %q", name))
+		}
+	}
+
+	for _, alias := range slices.Sorted(maps.Keys(b.sortFields)) {
+		cfg := b.sortFields[alias]
+		if _, ok := b.relations[cfg.Relation]; cfg.Relation != "" && !ok {
+			errs = append(errs, fmt.Errorf("sqlist: sort field %q refers to unknown relation %q", alias, cfg.Relation))
+		}
+		for _, name := range cfg.Joins {
+			if !joins[name] {
+				errs = append(errs, fmt.Errorf("sqlist: sort field %q requires unknown join %q", alias, name))
+			}
+		}
+	}
+
+	for _, field := range slices.Sorted(maps.Keys(b.fieldConfigs)) {
+		configs := append([]FieldConfig{b.fieldConfigs[field]}, b.fieldVariants[field]...)
+		reported := make(map[string]bool)
+
+		for _, cfg := range configs {
+			if strings.TrimSpace(cfg.DBField) == "" {
+				errs = append(errs, fmt.Errorf("sqlist: field %q has empty DBField", field))
+				continue
+			}
+
+			if _, ok := b.relations[cfg.Relation]; cfg.Relation != "" && !ok {
+				errs = append(errs, fmt.Errorf("sqlist: field %q refers to unknown relation %q", field, cfg.Relation))
+			}
+			if cfg.Relation != "" && cfg.Aggregate {
+				errs = append(errs, fmt.Errorf("sqlist: aggregate field %q cannot refer to relation %q", field, cfg.Relation))
+			}
+
+			for _, name := range cfg.Joins {
+				if !joins[name] {
+					errs = append(errs, fmt.Errorf("sqlist: field %q requires unknown join %q", field, name))
+				}
+			}
+
+			if _, ok := b.lookupOp(cfg.Operator); !ok {
+				errs = append(errs, fmt.Errorf("sqlist: field %q has unknown operator %q", field, cfg.Operator))
+			}
+
+			// точки внутри строковых литералов ('%@corp.com') не ссылаются на таблицы
+			expr := stringLiteral.ReplaceAllString(cfg.DBField, "''")
+
+			// таблицы коррелированных подзапросов видны только внутри выражения
+			local := make(map[string]bool)
+			expr = innerSource.ReplaceAllStringFunc(expr, func(declaration string) string {
+				match := innerSource.FindStringSubmatch(declaration)
+				local[match[1]] = true
+				if i := strings.LastIndex(match[1], "."); i >= 0 {
+					local[match[1][i+1:]] = true
+				}
+				if match[2] != "" {
+					local[match[2]] = true
+				}
+				return ""
+			})
+
+			for _, match := range qualifiedColumn.FindAllStringSubmatch(expr, -1) {
+				if match[2] != "" {
+					continue // вызов функции со схемой
+				}
+				qualifier := match[1]
+				if i := strings.LastIndex(qualifier, "."); i >= 0 && !sources[qualifier] && !local[qualifier] {
+					qualifier = qualifier[i+1:] // схема.таблица.колонка
+				}
+				if !sources[qualifier] && !local[qualifier] && !reported[qualifier] {
+					reported[qualifier] = true
+					errs = append(errs, fmt.Errorf("sqlist: field %q refers to unknown source %q", field, qualifier))
+				}
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// sources возвращает имена и алиасы таблиц из FROM, JOIN и связей
+func (b *SQLBuilder) sources() map[string]bool {
+	sources := make(map[string]bool)
+
+	tables := []string{b.fromTable}
+	for _, join := range b.joins {
+		tables = append(tables, join.Table)
+	}
+	for _, relation := range b.relations {
+		tables = append(tables, relation.Table)
+	}
+
+	for _, table := range tables {
+		parts := strings.Fields(table)
+		if len(parts) == 0 {
+			continue
+		}
+
+		// имя таблицы, в том числе без схемы
+		name := parts[0]
+		sources[name] = true
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			sources[name[i+1:]] = true
+		}
+
+		// алиас: "users u" или "users AS u"
+		if len(parts) > 1 {
+			sources[parts[len(parts)-1]] = true
+		}
+	}
+
+	return sources
+}
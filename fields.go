@@ -0,0 +1,181 @@
+package sqlist
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// AlwaysSelected включает поле в выборку независимо от запрошенных через ApplyFields
+func AlwaysSelected() FieldOption {
+	return func(cfg *FieldConfig) {
+		cfg.Always = true
+	}
+}
+
+// WithSelectField регистрирует поле выборки, которое клиент может запросить по алиасу.
+// В запрос поле попадает как "expr AS alias"
+func (b *SQLBuilder) WithSelectField(alias, expr string, opts ...FieldOption) *SQLBuilder {
+	if _, exists := b.selectFields[alias]; exists {
+		b.addConfigError(fmt.Errorf("sqlist: select field %q is already configured", alias))
+		return b
+	}
+
+	if b.selectFields == nil {
+		b.selectFields = make(map[string]FieldConfig)
+	}
+	b.selectFields[alias] = newFieldConfig(expr, "", opts)
+	b.selectOrder = append(b.selectOrder, alias)
+
+	return b
+}
+
+// ApplyFields ограничивает выборку запрошенными полями (например, fields=id,name).
+// Обязательные поля (AlwaysSelected) выбираются всегда, неизвестные имена - ошибка.
+// Без вызова ApplyFields или с пустым списком (параметр fields не передан)
+// выбираются все зарегистрированные поля
+func (b *SQLBuilder) ApplyFields(fields []string) *SQLBuilder {
+	requested := splitValues(fields)
+	if len(requested) == 0 {
+		return b
+	}
+
+	for _, field := range requested {
+		if _, ok := b.selectFields[field]; !ok {
+			b.addError(fmt.Errorf("sqlist: unknown field %q", field))
+			return b
+		}
+	}
+
+	b.requestedFields = requested
+	return b
+}
+
+// SelectedFields возвращает имена колонок результата в порядке выборки
+func (b *SQLBuilder) SelectedFields() []string {
+	columns := make([]string, 0, len(b.fields)+len(b.selectOrder))
+	for _, column := range b.fixedColumns() {
+		columns = append(columns, columnName(column))
+	}
+	return append(columns, b.projection()...)
+}
+
+// fixedColumns возвращает колонки WithFields с учетом прав: колонка, совпадающая
+// с полем фильтрации или выборки по выражению или имени, требует его прав.
+// Без прав колонка отбрасывается, а для поля выборки с Masked выбирается как NULL
+func (b *SQLBuilder) fixedColumns() []string {
+	columns := make([]string, 0, len(b.fields))
+	for _, column := range b.fields {
+		expr, name := column, columnName(column)
+		if i := strings.LastIndex(strings.ToUpper(column), " AS "); i >= 0 {
+			expr = strings.TrimSpace(column[:i])
+		}
+
+		permitted, masked := true, false
+		for alias, cfg := range b.fieldConfigs {
+			if alias == name || cfg.DBField == expr {
+				_, missing := b.missingPermission(cfg.Permissions)
+				permitted = permitted && !missing
+			}
+		}
+		for alias, cfg := range b.selectFields {
+			if alias == name || cfg.DBField == expr {
+				_, missing := b.missingPermission(cfg.Permissions)
+				permitted = permitted && !missing
+				masked = masked || cfg.Masked
+			}
+		}
+
+		switch {
+		case permitted:
+			columns = append(columns, column)
+		case masked:
+			columns = append(columns, "NULL AS "+name)
+		}
+	}
+	return columns
+}
+
+// projection возвращает алиасы выбираемых полей в порядке регистрации.
+// Поля без прав отбрасываются, если они не маскируются
+func (b *SQLBuilder) projection() []string {
+	aliases := make([]string, 0, len(b.selectOrder))
+	for _, alias := range b.selectOrder {
+		cfg := b.selectFields[alias]
+		if b.requestedFields != nil && !cfg.Always && !slices.Contains(b.requestedFields, alias) {
+			continue
+		}
+		if !cfg.Masked && !b.selectPermitted(alias) {
+			continue
+		}
+		aliases = append(aliases, alias)
+	}
+	return aliases
+}
+
+// selectColumns возвращает выражения колонок для SELECT
+func (b *SQLBuilder) selectColumns() []string {
+	columns := b.fixedColumns()
+	for _, alias := range b.projection() {
+		expr := b.selectFields[alias].DBField
+		if !b.selectPermitted(alias) {
+			expr = "NULL"
+		}
+		if expr != alias {
+			expr += " AS " + alias
+		}
+		columns = append(columns, expr)
+	}
+	return columns
+}
+
+// ScanDest возвращает указатели на поля структуры dest в порядке SelectedFields,
+// чтобы сканировать строку с запрошенным набором колонок: rows.Scan(dest...).
+// Колонка сопоставляется с полем по тегу `db`, иначе по имени поля; регистр не учитывается
+func (b *SQLBuilder) ScanDest(dest any) ([]any, error) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("sqlist: scan destination must be a pointer to struct, got %T", dest)
+	}
+	v = v.Elem()
+
+	targets := make(map[string]any, v.NumField())
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := strings.ToLower(field.Name)
+		if tag, _, _ := strings.Cut(field.Tag.Get("db"), ","); tag == "-" {
+			continue
+		} else if tag != "" {
+			name = strings.ToLower(tag)
+		}
+		targets[name] = v.Field(i).Addr().Interface()
+	}
+
+	columns := b.SelectedFields()
+	result := make([]any, 0, len(columns))
+	for _, column := range columns {
+		target, ok := targets[strings.ToLower(column)]
+		if !ok {
+			return nil, fmt.Errorf("sqlist: no field for column %q in %T", column, dest)
+		}
+		result = append(result, target)
+	}
+
+	return result, nil
+}
+
+// columnName возвращает имя колонки результата: "u.name" -> "name", "count(*) AS total" -> "total"
+func columnName(column string) string {
+	if i := strings.LastIndex(strings.ToUpper(column), " AS "); i >= 0 {
+		return strings.TrimSpace(column[i+4:])
+	}
+	if i := strings.LastIndex(column, "."); i >= 0 {
+		return column[i+1:]
+	}
+	return column
+}
@@ -0,0 +1,55 @@
+package sqlist
+
+import (
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// Aggregate отмечает поле-агрегат сгруппированного списка (например, SUM(o.total)).
+// Фильтры по нему попадают в HAVING, а не в WHERE
+func Aggregate() FieldOption {
+	return func(cfg *FieldConfig) {
+		cfg.Aggregate = true
+	}
+}
+
+// WithGroupBy переводит список в режим группировки: строки группируются по выражениям columns.
+// BuildCount в этом режиме считает группы, а BuildFacets, BuildDistinct, BuildAggregates
+// и BuildTimeSeries возвращают ошибку. Ленивые JOIN для выражений задает WithGroupByJoins
+func (b *SQLBuilder) WithGroupBy(columns ...string) *SQLBuilder {
+	b.groupBy = append(b.groupBy, columns...)
+	return b
+}
+
+// WithGroupByJoins задает именованные JOIN, на которые ссылаются выражения WithGroupBy.
+// Они подключаются всегда, даже если поля выборки с этими JOIN не запрошены
+func (b *SQLBuilder) WithGroupByJoins(names ...string) *SQLBuilder {
+	b.groupJoins = append(b.groupJoins, names...)
+	return b
+}
+
+// grouped проверяет, строится ли сгруппированный список
+func (b *SQLBuilder) grouped() bool {
+	return len(b.groupBy) > 0 || len(b.havingConditions) > 0
+}
+
+// requireUngrouped возвращает ошибку для запросов, которые строятся по строкам, а не по группам:
+// без GROUP BY и HAVING такой запрос молча потерял бы фильтры по агрегатам
+func (b *SQLBuilder) requireUngrouped(query string) error {
+	if b.grouped() {
+		return fmt.Errorf("sqlist: %s is not supported for grouped lists", query)
+	}
+	return nil
+}
+
+// withGroupBy добавляет в селект GROUP BY и HAVING
+func (b *SQLBuilder) withGroupBy(selectBuilder sq.SelectBuilder) sq.SelectBuilder {
+	if len(b.groupBy) > 0 {
+		selectBuilder = selectBuilder.GroupBy(b.groupBy...)
+	}
+	if len(b.havingConditions) > 0 {
+		selectBuilder = selectBuilder.Having(sq.And(b.havingConditions))
+	}
+	return selectBuilder
+}
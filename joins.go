@@ -0,0 +1,210 @@
+package sqlist
+
+import (
+	"fmt"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// Joins указывает именованные JOIN (см. WithLazyJoin), без которых поле не работает.
+// Они добавляются в запрос, только если поле участвует в фильтре, сортировке или выборке
+func Joins(names ...string) FieldOption {
+	return func(cfg *FieldConfig) {
+		cfg.Joins = append(cfg.Joins, names...)
+	}
+}
+
+// WithLazyJoin регистрирует именованный JOIN, который попадает в запрос только когда нужен
+// активному фильтру, сортировке или полю выборки. dependsOn - JOIN, которые должны идти раньше.
+// Ленивым бывает только LEFT JOIN: остальные меняют набор строк, поэтому добавляются всегда,
+// иначе COUNT и страница с другим набором полей или сортировкой считали бы разные строки
+func (b *SQLBuilder) WithLazyJoin(name, joinType, table, condition string, dependsOn ...string) *SQLBuilder {
+	return b.withLazyJoin(joinConfig{
+		Name:      name,
+		Type:      joinType,
+		Table:     table,
+		Condition: condition,
+		DependsOn: dependsOn,
+	})
+}
+
+// withLazyJoin регистрирует именованный JOIN, повторное имя - ошибка конфигурации
+func (b *SQLBuilder) withLazyJoin(join joinConfig) *SQLBuilder {
+	for _, existing := range b.joins {
+		if existing.Name == join.Name {
+			b.addConfigError(fmt.Errorf("sqlist: join %q is already configured", join.Name))
+			return b
+		}
+	}
+
+	b.joins = append(b.joins, join)
+	return b
+}
+
+// WithLazyLeftJoin регистрирует именованный LEFT JOIN
+func (b *SQLBuilder) WithLazyLeftJoin(name, table, condition string, dependsOn ...string) *SQLBuilder {
+	return b.WithLazyJoin(name, "LEFT JOIN", table, condition, dependsOn...)
+}
+
+// WithLazyInnerJoin регистрирует именованный JOIN. Он отсекает строки и попадает во все запросы,
+// имя нужно для зависимостей других JOIN
+func (b *SQLBuilder) WithLazyInnerJoin(name, table, condition string, dependsOn ...string) *SQLBuilder {
+	return b.WithLazyJoin(name, "JOIN", table, condition, dependsOn...)
+}
+
+// WithLateralJoin добавляет JOIN LATERAL с подзапросом, например последний комментарий к посту:
+// WithLateralJoin("LEFT JOIN", sq.Select("c.text").From("comments c").Where("c.post_id = p.id").
+// OrderBy("c.created_at DESC").Limit(1), "lc"). Подзапрос может содержать свои аргументы,
+// условие соединения - ON true
+func (b *SQLBuilder) WithLateralJoin(joinType string, subquery sq.Sqlizer, alias string) *SQLBuilder {
+	b.joins = append(b.joins, joinConfig{
+		Type:      joinType,
+		Table:     alias,
+		Condition: "true",
+		Subquery:  subquery,
+	})
+	return b
+}
+
+// WithLazyLateralJoin регистрирует именованный JOIN LATERAL, который попадает в запрос
+// только когда нужен полю фильтра, сортировки или выборки (см. Joins)
+func (b *SQLBuilder) WithLazyLateralJoin(name, joinType string, subquery sq.Sqlizer, alias string, dependsOn ...string) *SQLBuilder {
+	return b.withLazyJoin(joinConfig{
+		Name:      name,
+		Type:      joinType,
+		Table:     alias,
+		Condition: "true",
+		Subquery:  subquery,
+		DependsOn: dependsOn,
+	})
+}
+
+// ToSql строит JOIN вместе с аргументами условия и подзапроса LATERAL
+func (j joinConfig) ToSql() (string, []interface{}, error) {
+	if j.Subquery == nil {
+		return fmt.Sprintf("%s %s ON %s", j.Type, j.Table, j.Condition), j.Args, nil
+	}
+
+	sql, args, err := nestedSQL(j.Subquery)
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("%s LATERAL (%s) %s ON %s", j.Type, sql, j.Table, j.Condition), append(args, j.Args...), nil
+}
+
+// left сообщает, что JOIN не отсекает строки основной таблицы
+func (j joinConfig) left() bool {
+	return strings.HasPrefix(strings.ToUpper(strings.TrimSpace(j.Type)), "LEFT")
+}
+
+// nestedSQL строит вложенный запрос с плейсхолдерами "?": их нумерует внешний запрос.
+// Иначе подзапрос с форматом Dollar начинал бы нумерацию заново с $1
+func nestedSQL(query sq.Sqlizer) (string, []interface{}, error) {
+	if selectBuilder, ok := query.(sq.SelectBuilder); ok {
+		query = selectBuilder.PlaceholderFormat(sq.Question)
+	}
+	return query.ToSql()
+}
+
+// useJoins отмечает JOIN, нужные активным фильтрам
+func (b *SQLBuilder) useJoins(names []string) {
+	if len(names) == 0 {
+		return
+	}
+	if b.filterJoins == nil {
+		b.filterJoins = make(map[string]bool)
+	}
+	for _, name := range names {
+		b.filterJoins[name] = true
+	}
+}
+
+// requiredJoins собирает имена JOIN, нужных фильтрам, а также сортировке, выборке и группировке,
+// если они участвуют в запросе
+func (b *SQLBuilder) requiredJoins(withSort, withProjection bool) map[string]bool {
+	required := make(map[string]bool, len(b.filterJoins))
+	for name := range b.filterJoins {
+		required[name] = true
+	}
+
+	if withSort {
+		for _, name := range b.sort.joins {
+			required[name] = true
+		}
+	}
+
+	if withProjection {
+		for _, name := range b.groupJoins {
+			required[name] = true
+		}
+		for _, alias := range b.projection() {
+			for _, name := range b.selectFields[alias].Joins {
+				required[name] = true
+			}
+		}
+	}
+
+	return required
+}
+
+// resolveJoins возвращает JOIN для запроса: все обычные, все именованные кроме LEFT
+// и нужные именованные LEFT, в порядке регистрации, с зависимостями перед зависимыми
+func (b *SQLBuilder) resolveJoins(required map[string]bool) ([]joinConfig, error) {
+	byName := make(map[string]joinConfig)
+	for _, join := range b.joins {
+		if join.Name != "" {
+			byName[join.Name] = join
+		}
+	}
+
+	for name := range required {
+		if _, ok := byName[name]; !ok {
+			return nil, fmt.Errorf("sqlist: unknown join %q", name)
+		}
+	}
+
+	var (
+		result  []joinConfig
+		added   = make(map[string]bool)
+		visited = make(map[string]bool)
+		visit   func(name string) error
+	)
+
+	visit = func(name string) error {
+		if added[name] {
+			return nil
+		}
+		if visited[name] {
+			return fmt.Errorf("sqlist: join %q depends on itself", name)
+		}
+		visited[name] = true
+
+		join, ok := byName[name]
+		if !ok {
+			return fmt.Errorf("sqlist: unknown join %q", name)
+		}
+		for _, dependency := range join.DependsOn {
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+
+		added[name] = true
+		result = append(result, join)
+		return nil
+	}
+
+	for _, join := range b.joins {
+		switch {
+		case join.Name == "":
+			result = append(result, join)
+		case required[join.Name] || !join.left():
+			if err := visit(join.Name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return result, nil
+}
@@ -1,6 +1,10 @@
 package sqlist
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
 	"github.com/Masterminds/squirrel"
 )
 
@@ -125,6 +129,22 @@ func (b *SQLBuilder) ILike(field string, value string) *SQLBuilder {
 	return b
 }
 
+// NotLike добавляет условие NOT LIKE
+func (b *SQLBuilder) NotLike(field string, value string) *SQLBuilder {
+	if value != "" {
+		b.whereConditions = append(b.whereConditions, squirrel.NotLike{b.mapField(field): value + "%"})
+	}
+	return b
+}
+
+// NotILike добавляет условие NOT ILIKE
+func (b *SQLBuilder) NotILike(field string, value string) *SQLBuilder {
+	if value != "" {
+		b.whereConditions = append(b.whereConditions, squirrel.NotILike{b.mapField(field): "%" + value + "%"})
+	}
+	return b
+}
+
 // In добавляет условие IN
 func (b *SQLBuilder) In(field string, values interface{}) *SQLBuilder {
 	if values != nil {
@@ -210,6 +230,27 @@ func (b *SQLBuilder) And(conditions ...squirrel.Sqlizer) *SQLBuilder {
 	return b
 }
 
+// Not добавляет отрицание условия: NOT (...)
+func (b *SQLBuilder) Not(condition squirrel.Sqlizer) *SQLBuilder {
+	if condition != nil {
+		b.whereConditions = append(b.whereConditions, notCondition{condition})
+	}
+	return b
+}
+
+// notCondition отрицание произвольного условия
+type notCondition struct {
+	condition squirrel.Sqlizer
+}
+
+func (n notCondition) ToSql() (string, []interface{}, error) {
+	sql, args, err := n.condition.ToSql()
+	if err != nil {
+		return "", nil, err
+	}
+	return "NOT (" + sql + ")", args, nil
+}
+
 // ExprEq добавляет условие с функцией с правой стороны
 // Пример: persons.snils2bcd64(snils) = persons.snils2bcd64('111-111-111 11')
 func (b *SQLBuilder) ExprEq(leftField, rightExpr string, args ...interface{}) *SQLBuilder {
@@ -226,18 +267,125 @@ func (b *SQLBuilder) ExprEq(leftField, rightExpr string, args ...interface{}) *S
 	return b
 }
 
+// ============= МЕТОДЫ ДЛЯ МАССИВОВ =============
+
+// ArrayContains добавляет условие "колонка содержит все значения".
+// PostgreSQL: col @> ?, MySQL (JSON-колонка): JSON_CONTAINS(col, ?)
+func (b *SQLBuilder) ArrayContains(field string, values interface{}) *SQLBuilder {
+	return b.arrayCondition(ARRAY_CONTAINS, field, values)
+}
+
+// ArrayOverlaps добавляет условие "колонка содержит хотя бы одно значение".
+// PostgreSQL: col && ?, MySQL (JSON-колонка): JSON_OVERLAPS(col, ?)
+func (b *SQLBuilder) ArrayOverlaps(field string, values interface{}) *SQLBuilder {
+	return b.arrayCondition(ARRAY_OVERLAPS, field, values)
+}
+
+// ArrayContainedBy добавляет условие "все элементы колонки входят в значения".
+// PostgreSQL: col <@ ?, MySQL (JSON-колонка): JSON_CONTAINS(?, col)
+func (b *SQLBuilder) ArrayContainedBy(field string, values interface{}) *SQLBuilder {
+	return b.arrayCondition(ARRAY_CONTAINED_BY, field, values)
+}
+
+// AnyEq добавляет условие "колонка равна одному из значений".
+// PostgreSQL: col = ANY(?) с одним параметром-массивом, в остальных диалектах: col IN (?, ...)
+func (b *SQLBuilder) AnyEq(field string, values interface{}) *SQLBuilder {
+	if values != nil {
+		b.whereConditions = append(b.whereConditions, anyEqExpr(b.dialect, b.mapField(field), values))
+	}
+	return b
+}
+
+// arrayCondition добавляет условие над колонкой-массивом с учетом диалекта
+func (b *SQLBuilder) arrayCondition(op Op, field string, values interface{}) *SQLBuilder {
+	if values == nil {
+		return b
+	}
+
+	condition, err := arrayExpr(op, b.dialect, b.mapField(field), values)
+	if err != nil {
+		b.addError(err)
+		return b
+	}
+
+	b.whereConditions = append(b.whereConditions, condition)
+	return b
+}
+
+// anyEqExpr строит условие ANY_EQ для диалекта
+func anyEqExpr(dialect Dialect, column string, values interface{}) squirrel.Sqlizer {
+	if dialect != PostgreSQL {
+		return squirrel.Eq{column: values}
+	}
+	return squirrel.Expr(column+" = ANY(?)", values)
+}
+
+// arrayExpr строит условие над колонкой-массивом для диалекта
+func arrayExpr(op Op, dialect Dialect, column string, values interface{}) (squirrel.Sqlizer, error) {
+	switch dialect {
+	case PostgreSQL:
+		operators := map[Op]string{
+			ARRAY_CONTAINS:     " @> ?",
+			ARRAY_OVERLAPS:     " && ?",
+			ARRAY_CONTAINED_BY: " <@ ?",
+		}
+		return squirrel.Expr(column+operators[op], values), nil
+	case MySQL:
+		// в MySQL массивы хранятся в JSON, значения передаем JSON-массивом
+		doc, err := json.Marshal(values)
+		if err != nil {
+			return nil, err
+		}
+		templates := map[Op]string{
+			ARRAY_CONTAINS:     "JSON_CONTAINS(" + column + ", ?)",
+			ARRAY_OVERLAPS:     "JSON_OVERLAPS(" + column + ", ?)",
+			ARRAY_CONTAINED_BY: "JSON_CONTAINS(?, " + column + ")",
+		}
+		return squirrel.Expr(templates[op], string(doc)), nil
+	}
+
+	return nil, unsupported(op, dialect)
+}
+
 // ============= МЕТОДЫ ДЛЯ СОРТИРОВКИ И ПАГИНАЦИИ =============
 
-// Sort устанавливает сортировку
+// Sort устанавливает сортировку по полю фильтрации, полю сортировки (см. WithSortField) или колонке.
+// Поле с SortOrder сортируется по позиции значения в списке, а не по алфавиту
 func (b *SQLBuilder) Sort(field, order string) *SQLBuilder {
-	b.sort = SortConfig{Field: b.mapField(field), Order: order}
+	column := field
+	cfg, ok := b.fieldConfigs[field]
+	if ok {
+		if !b.checkPermissions(field, cfg) {
+			return b
+		}
+		column = cfg.DBField
+	}
+
+	if sortCfg, ok := b.sortFields[field]; ok {
+		if !b.checkPermissions(field, sortCfg) {
+			return b
+		}
+		expr, err := b.sortFieldExpr(sortCfg)
+		if err != nil {
+			b.addError(err)
+			return b
+		}
+		cfg, column = sortCfg, expr
+	}
+	b.sort = SortConfig{Field: column, Order: order, alias: field, joins: cfg.Joins, aggregate: cfg.Aggregate}
+
+	if len(cfg.SortValues) > 0 {
+		values := cfg.SortValues
+		b.sort.Field, b.sort.args = enumExpr(column, values)
+		b.sort.key = func(value any) any { return enumRank(values, value) }
+	}
 	return b
 }
 
 // SortIf устанавливает сортировку, если поле не пустое
 func (b *SQLBuilder) SortIf(field, order string) *SQLBuilder {
 	if field != "" {
-		b.sort = SortConfig{Field: b.mapField(field), Order: order}
+		b.Sort(field, order)
 	}
 	return b
 }
@@ -248,7 +396,7 @@ func (b *SQLBuilder) Limit(limit uint64) *SQLBuilder {
 		return b
 	}
 
-	b.limit = limit
+	b.limit = b.clampLimit(limit)
 
 	return b
 }
@@ -264,27 +412,86 @@ func (b *SQLBuilder) Page(page, pageSize uint64) *SQLBuilder {
 	if page < 1 {
 		page = 1
 	}
+	pageSize = b.clampLimit(pageSize)
 	b.limit = pageSize
 	b.offset = (page - 1) * pageSize
 	return b
 }
 
-func (b *SQLBuilder) WithFieldConfig(field string, dbField string, op Op) *SQLBuilder {
+// WithMaxLimit ограничивает размер страницы, запрошенный через Limit и Page
+func (b *SQLBuilder) WithMaxLimit(maxLimit uint64) *SQLBuilder {
+	b.maxLimit = maxLimit
+	b.limit = b.clampLimit(b.limit)
+	return b
+}
+
+// clampLimit ограничивает лимит значением maxLimit
+func (b *SQLBuilder) clampLimit(limit uint64) uint64 {
+	if b.maxLimit > 0 && limit > b.maxLimit {
+		return b.maxLimit
+	}
+	return limit
+}
+
+// WithNullTokens задает значения фильтра, означающие IS NULL и IS NOT NULL
+// для полей с опцией Nullable. По умолчанию "null" и "!null"
+func (b *SQLBuilder) WithNullTokens(null, notNull string) *SQLBuilder {
+	b.nullToken = null
+	b.notNullToken = notNull
+	return b
+}
+
+// WithFieldConfig настраивает фильтрацию поля: колонку в БД, оператор и дополнительные опции.
+// Повторная настройка поля - ошибка, если режим не разрешает несколько операторов
+// (см. WithFieldConfigMode). Заменить настройку можно через OverrideFieldConfig
+func (b *SQLBuilder) WithFieldConfig(field string, dbField string, op Op, opts ...FieldOption) *SQLBuilder {
 	if b.fieldConfigs == nil {
 		b.fieldConfigs = make(map[string]FieldConfig)
 	}
 
-	b.fieldConfigs[field] = FieldConfig{
-		DBField:  dbField,
-		Operator: op,
+	cfg := newFieldConfig(dbField, op, opts)
+
+	primary, exists := b.fieldConfigs[field]
+	if !exists {
+		b.fieldConfigs[field] = cfg
+		return b
+	}
+
+	if b.fieldConfigMode != FieldConfigMulti || primary.Operator == op || b.hasFieldVariant(field, op) {
+		b.duplicateFields = append(b.duplicateFields, field)
+		b.addConfigError(fmt.Errorf("sqlist: field %q is already configured", field))
+		return b
 	}
 
+	if b.fieldVariants == nil {
+		b.fieldVariants = make(map[string][]FieldConfig)
+	}
+	b.fieldVariants[field] = append(b.fieldVariants[field], cfg)
+
 	return b
 }
 
 // ApplyFilter применяет фильтр. Удобно использовать для установки фильтров в цикле
 func (b *SQLBuilder) ApplyFilter(field string, value string) *SQLBuilder {
-	if value == "" {
+	return b.ApplyFilterValues(field, value)
+}
+
+// ApplyFilterValues применяет фильтр с несколькими значениями (например, из url.Values).
+// Условие строит оператор поля из реестра (см. RegisterOp, WithOp).
+// Модификатор [not] в имени поля инвертирует фильтр: "status[not]" = "archived",
+// модификатор с именем оператора выбирает одну из настроек поля: "price[gte]" = "10"
+func (b *SQLBuilder) ApplyFilterValues(field string, values ...string) *SQLBuilder {
+	if len(values) == 0 || values[0] == "" {
+		return b
+	}
+
+	if field == b.presetParam && len(b.presets) > 0 {
+		return b.ApplyPreset(values...)
+	}
+
+	field, fieldOp, negate, err := parseFilterKey(field)
+	if err != nil {
+		b.addError(err)
 		return b
 	}
 
@@ -293,41 +500,171 @@ func (b *SQLBuilder) ApplyFilter(field string, value string) *SQLBuilder {
 		странный мув: если настроек поля нет, то ничего не делаем
 		если мои build-методы возвращают sql, args, err, то, можно писать ошибку!!!
 	*/
-	cfg, ok := b.fieldConfigs[field]
+	if _, ok := b.fieldConfigs[field]; !ok {
+		return b.applyRelationFilter(field, fieldOp, negate, values[0])
+	}
+
+	cfg, ok := b.fieldConfig(field, fieldOp)
 	if !ok {
+		b.addError(fmt.Errorf("sqlist: field %q has no operator %q", field, fieldOp))
 		return b
 	}
 
-	switch cfg.Operator {
-	case EQ:
-		b.Eq(cfg.DBField, value)
-	case NOT_EQ:
-		b.NotEq(cfg.DBField, value)
-	case LIKE:
-		b.Like(cfg.DBField, value)
-	case ILIKE:
-		b.ILike(cfg.DBField, value)
-	case GT:
-		b.Gt(cfg.DBField, value)
-	case LT:
-		b.Lt(cfg.DBField, value)
-	case GTE:
-		b.Gte(cfg.DBField, value)
-	case LTE:
-		b.Lte(cfg.DBField, value)
+	if !b.checkPermissions(field, cfg) {
+		return b
+	}
+
+	// фильтр по связанной таблице инвертируется целиком: NOT EXISTS (...)
+	negateRelation := cfg.Relation != "" && negate
+	if negateRelation {
+		negate = false
+	}
+
+	condition, err := b.filterCondition(field, cfg, values, negate)
+	if err != nil {
+		b.addError(err)
+		return b
+	}
+
+	switch c := condition.(type) {
+	case nil:
+	case squirrel.And:
+		// составные условия (диапазоны) добавляем по частям, как и отдельные вызовы Gte/Lt
+		b.addFilterCondition(field, cfg, negateRelation, c...)
+	default:
+		b.addFilterCondition(field, cfg, negateRelation, c)
 	}
 
 	return b
 }
 
-// MapField возвращает настоящее имя колонки по псевдониму
+// filterCondition строит условие фильтра оператором поля из реестра
+func (b *SQLBuilder) filterCondition(field string, cfg FieldConfig, values []string, negate bool) (squirrel.Sqlizer, error) {
+	value := values[0]
+	if cfg.Nullable && (value == b.nullToken || value == b.notNullToken) {
+		if (value == b.nullToken) != negate {
+			return squirrel.Eq{cfg.DBField: nil}, nil
+		}
+		return squirrel.NotEq{cfg.DBField: nil}, nil
+	}
+
+	// у большинства операторов есть парный отрицательный, остальные оборачиваются в NOT (...)
+	op := cfg.Operator
+	if negated, ok := negatedOps[op]; ok && negate {
+		op, negate = negated, false
+	}
+
+	fn, ok := b.lookupOp(op)
+	if !ok {
+		return nil, fmt.Errorf("sqlist: unknown operator %q for field %q", op, field)
+	}
+
+	condition, err := fn(OpEnv{b: b}, cfg.DBField, values, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("sqlist: filter %q: %w", field, err)
+	}
+
+	if condition != nil && negate {
+		condition = notCondition{condition}
+	}
+
+	return condition, nil
+}
+
+// addFilterCondition добавляет условия фильтра в WHERE, HAVING или в подзапрос связи.
+// Условия в WHERE помечаются полем, чтобы фасеты могли исключить собственный фильтр
+func (b *SQLBuilder) addFilterCondition(field string, cfg FieldConfig, negateRelation bool, conditions ...squirrel.Sqlizer) {
+	if cfg.Relation != "" {
+		b.addRelationCondition(cfg.Relation, negateRelation, conditions...)
+		return
+	}
+
+	b.useJoins(cfg.Joins)
+	for _, condition := range conditions {
+		if cfg.Aggregate {
+			b.havingConditions = append(b.havingConditions, fieldCondition{field: field, Sqlizer: condition})
+			continue
+		}
+		b.whereConditions = append(b.whereConditions, fieldCondition{field: field, Sqlizer: condition})
+	}
+}
+
+// fieldCondition условие фильтра по полю
+type fieldCondition struct {
+	field string
+	squirrel.Sqlizer
+}
+
+// negatedOps пары взаимно обратных операторов
+var negatedOps = map[Op]Op{
+	EQ:          NOT_EQ,
+	NOT_EQ:      EQ,
+	LIKE:        NOT_LIKE,
+	NOT_LIKE:    LIKE,
+	ILIKE:       NOT_ILIKE,
+	NOT_ILIKE:   ILIKE,
+	IN:          NOT_IN,
+	NOT_IN:      IN,
+	RANGE:       NOT_RANGE,
+	NOT_RANGE:   RANGE,
+	IS_NULL:     IS_NOT_NULL,
+	IS_NOT_NULL: IS_NULL,
+}
+
+// modifierNot модификатор имени поля, инвертирующий фильтр
+const modifierNot = "not"
+
+// parseFilterKey разбирает имя поля с модификаторами: "status[not]", "price[gte]".
+// Модификатор, отличный от [not], выбирает оператор поля
+func parseFilterKey(key string) (field string, op Op, negate bool, err error) {
+	field, rest, found := strings.Cut(key, "[")
+	if !found {
+		return key, "", false, nil
+	}
+
+	for _, modifier := range strings.Split(strings.TrimSuffix(rest, "]"), "][") {
+		switch {
+		case modifier == modifierNot:
+			negate = !negate
+		case modifier != "" && op == "":
+			op = Op(modifier)
+		default:
+			return "", "", false, fmt.Errorf("sqlist: invalid modifier %q in filter %q", modifier, key)
+		}
+	}
+
+	return field, op, negate, nil
+}
+
+// splitValues разбивает значения вида "a,b" и отбрасывает пустые
+func splitValues(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				result = append(result, part)
+			}
+		}
+	}
+	return result
+}
+
+// MapField возвращает настоящее имя колонки по псевдониму.
+// Используется условиями, поэтому отмечает ленивые JOIN поля как нужные фильтрам
 func (b *SQLBuilder) mapField(alias string) string {
 	if cfg, ok := b.fieldConfigs[alias]; ok {
+		b.checkPermissions(alias, cfg)
+		b.useJoins(cfg.Joins)
 		return cfg.DBField
 	}
 	return alias // если не нашли, возвращаем как есть
 }
 
+// ApplyExpr применяет фильтр с выражением в правой части, заданным в месте вызова.
+// Для полей с оператором EXPR_* строится условие "DBField op value" с аргументами args.
+// Поле с обычным оператором сравнивает колонку с аргументами, шаблон value при этом не используется,
+// а без аргументов value передается в ApplyFilter как обычное значение фильтра.
+// Права, JOIN, связанные таблицы и агрегаты поля учитываются так же, как в ApplyFilter
 func (b *SQLBuilder) ApplyExpr(field string, value string, args ...any) *SQLBuilder {
 	if value == "" {
 		return b
@@ -338,13 +675,40 @@ func (b *SQLBuilder) ApplyExpr(field string, value string, args ...any) *SQLBuil
 		return b
 	}
 
-	/*
-		todo:
-		если не типы EXPR_{action}, то проксируем обращение
-	*/
-	if cfg.Operator != EXPR_EQ {
+	_, isExpr := exprOperators[cfg.Operator]
+	if !isExpr && len(args) == 0 {
 		return b.ApplyFilter(field, value)
 	}
 
-	return b.ExprEq(cfg.DBField, value, args...)
+	if !b.checkPermissions(field, cfg) {
+		return b
+	}
+
+	op, rightExpr := cfg.Operator, value
+	if !isExpr {
+		if op, ok = exprOps[cfg.Operator]; !ok {
+			b.addError(fmt.Errorf("sqlist: operator %q of field %q does not support expressions", cfg.Operator, field))
+			return b
+		}
+
+		rightExpr = "?"
+		if op == EXPR_IN {
+			rightExpr = squirrel.Placeholders(len(args))
+		}
+	}
+
+	args = append(append([]any{}, cfg.ExprArgs...), args...)
+	if expected := placeholderCount(cfg.DBField) + placeholderCount(rightExpr); expected != len(args) {
+		b.addError(fmt.Errorf("sqlist: expression for field %q expects %d args, got %d", field, expected, len(args)))
+		return b
+	}
+
+	condition, err := exprCondition(cfg.DBField, op, rightExpr, args...)
+	if err != nil {
+		b.addError(err)
+		return b
+	}
+
+	b.addFilterCondition(field, cfg, false, condition)
+	return b
 }
@@ -0,0 +1,120 @@
+package sqlist
+
+import (
+	"fmt"
+	"strconv"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// встроенные операторы ApplyFilter
+func init() {
+	for _, op := range []Op{EQ, NOT_EQ, GT, LT, GTE, LTE} {
+		registerOp(op, comparisonOp(op))
+	}
+
+	registerOp(LIKE, func(_ OpEnv, column string, values []string, _ FieldConfig) (sq.Sqlizer, error) {
+		return sq.Like{column: values[0] + "%"}, nil
+	})
+	registerOp(NOT_LIKE, func(_ OpEnv, column string, values []string, _ FieldConfig) (sq.Sqlizer, error) {
+		return sq.NotLike{column: values[0] + "%"}, nil
+	})
+	registerOp(ILIKE, func(_ OpEnv, column string, values []string, _ FieldConfig) (sq.Sqlizer, error) {
+		return sq.ILike{column: "%" + values[0] + "%"}, nil
+	})
+	registerOp(NOT_ILIKE, func(_ OpEnv, column string, values []string, _ FieldConfig) (sq.Sqlizer, error) {
+		return sq.NotILike{column: "%" + values[0] + "%"}, nil
+	})
+
+	// список без значений (",") не фильтрует, как и пустое значение
+	registerOp(IN, func(env OpEnv, column string, values []string, cfg FieldConfig) (sq.Sqlizer, error) {
+		values = splitValues(values)
+		if len(values) == 0 {
+			return nil, nil
+		}
+		parsed, err := env.ParseValues(cfg, values)
+		if err != nil {
+			return nil, err
+		}
+		return sq.Eq{column: parsed}, nil
+	})
+	registerOp(NOT_IN, func(env OpEnv, column string, values []string, cfg FieldConfig) (sq.Sqlizer, error) {
+		values = splitValues(values)
+		if len(values) == 0 {
+			return nil, nil
+		}
+		parsed, err := env.ParseValues(cfg, values)
+		if err != nil {
+			return nil, err
+		}
+		return sq.NotEq{column: parsed}, nil
+	})
+	registerOp(ANY_EQ, func(env OpEnv, column string, values []string, cfg FieldConfig) (sq.Sqlizer, error) {
+		values = splitValues(values)
+		if len(values) == 0 {
+			return nil, nil
+		}
+		parsed, err := env.ParseValues(cfg, values)
+		if err != nil {
+			return nil, err
+		}
+		return anyEqExpr(env.Dialect(), column, parsed), nil
+	})
+	for _, op := range []Op{ARRAY_CONTAINS, ARRAY_OVERLAPS, ARRAY_CONTAINED_BY} {
+		registerOp(op, arrayOp(op))
+	}
+
+	registerOp(RANGE, func(env OpEnv, column string, values []string, cfg FieldConfig) (sq.Sqlizer, error) {
+		return env.builder().rangeCondition(column, cfg, values[0])
+	})
+	registerOp(NOT_RANGE, func(env OpEnv, column string, values []string, cfg FieldConfig) (sq.Sqlizer, error) {
+		condition, err := env.builder().rangeCondition(column, cfg, values[0])
+		if err != nil {
+			return nil, err
+		}
+		return notCondition{condition}, nil
+	})
+
+	registerOp(IS_NULL, nullOp(true))
+	registerOp(IS_NOT_NULL, nullOp(false))
+
+	for op := range exprOperators {
+		registerOp(op, exprOp(op))
+	}
+}
+
+// comparisonOp оператор сравнения значения, приведенного к типу поля
+func comparisonOp(op Op) OpEnvFunc {
+	return func(env OpEnv, column string, values []string, cfg FieldConfig) (sq.Sqlizer, error) {
+		return env.builder().comparison(column, cfg, op, values[0])
+	}
+}
+
+// arrayOp оператор над колонкой-массивом
+func arrayOp(op Op) OpEnvFunc {
+	return func(env OpEnv, column string, values []string, cfg FieldConfig) (sq.Sqlizer, error) {
+		values = splitValues(values)
+		if len(values) == 0 {
+			return nil, nil
+		}
+		parsed, err := env.ParseValues(cfg, values)
+		if err != nil {
+			return nil, err
+		}
+		return arrayExpr(op, env.Dialect(), column, parsed)
+	}
+}
+
+// nullOp оператор IS NULL/IS NOT NULL по логическому значению фильтра
+func nullOp(isNull bool) OpEnvFunc {
+	return func(_ OpEnv, column string, values []string, _ FieldConfig) (sq.Sqlizer, error) {
+		flag, err := strconv.ParseBool(values[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid boolean value %q", values[0])
+		}
+		if flag == isNull {
+			return sq.Eq{column: nil}, nil
+		}
+		return sq.NotEq{column: nil}, nil
+	}
+}
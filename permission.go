@@ -0,0 +1,69 @@
+package sqlist
+
+import (
+	"fmt"
+	"slices"
+)
+
+// PermissionError возвращается build-методами, если фильтр или сортировка
+// используют поле, на которое у запроса нет прав
+type PermissionError struct {
+	Field      string // алиас поля
+	Permission string // недостающее право
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("sqlist: permission %q is required for field %q", e.Permission, e.Field)
+}
+
+// Permissions задает права, необходимые для фильтрации, сортировки и выборки поля
+func Permissions(permissions ...string) FieldOption {
+	return func(cfg *FieldConfig) {
+		cfg.Permissions = append(cfg.Permissions, permissions...)
+	}
+}
+
+// Masked выбирает поле без прав как NULL AS alias вместо того, чтобы убрать его из выборки
+func Masked() FieldOption {
+	return func(cfg *FieldConfig) {
+		cfg.Masked = true
+	}
+}
+
+// WithPermissions задает права текущего запроса (например, права роли пользователя)
+func (b *SQLBuilder) WithPermissions(permissions ...string) *SQLBuilder {
+	b.permissions = append(b.permissions, permissions...)
+	return b
+}
+
+// checkPermissions проверяет права на поле, при их нехватке сохраняет PermissionError.
+// Вместе с правами cfg проверяются права основной настройки поля: вариант оператора
+// (FieldConfigMulti) не открывает доступ к полю, закрытому первой настройкой
+func (b *SQLBuilder) checkPermissions(field string, cfg FieldConfig) bool {
+	required := slices.Concat(b.fieldConfigs[field].Permissions, cfg.Permissions)
+	if missing, ok := b.missingPermission(required); ok {
+		b.addError(&PermissionError{Field: field, Permission: missing})
+		return false
+	}
+	return true
+}
+
+// missingPermission возвращает первое право из required, которого нет у запроса
+func (b *SQLBuilder) missingPermission(required []string) (string, bool) {
+	for _, permission := range required {
+		if !slices.Contains(b.permissions, permission) {
+			return permission, true
+		}
+	}
+	return "", false
+}
+
+// selectPermitted проверяет права на поле выборки: его собственные и права
+// одноименного поля фильтрации
+func (b *SQLBuilder) selectPermitted(alias string) bool {
+	if _, missing := b.missingPermission(b.selectFields[alias].Permissions); missing {
+		return false
+	}
+	_, missing := b.missingPermission(b.fieldConfigs[alias].Permissions)
+	return !missing
+}
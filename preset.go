@@ -0,0 +1,111 @@
+package sqlist
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// defaultPresetParam имя фильтра, через который применяются пресеты: preset=overdue
+const defaultPresetParam = "preset"
+
+type (
+	// PresetFunc строит условие именованного пресета. Получает билдер запроса,
+	// например, чтобы взять текущее время пользователя через Now
+	PresetFunc func(b *SQLBuilder) sq.Sqlizer
+
+	// presetConfig именованный пресет фильтров
+	presetConfig struct {
+		fn         PresetFunc
+		applyByDef bool // применяется автоматически, см. WithDefaultPreset
+	}
+)
+
+// WithPreset регистрирует именованный пресет фильтров, который применяется по имени:
+// ApplyPreset("overdue") или фильтром preset=overdue
+func (b *SQLBuilder) WithPreset(name string, fn PresetFunc) *SQLBuilder {
+	return b.addPreset(name, presetConfig{fn: fn})
+}
+
+// WithDefaultPreset регистрирует пресет, который применяется к каждому запросу
+// (например, deleted_at IS NULL). Отключается через WithoutDefaultPresets
+func (b *SQLBuilder) WithDefaultPreset(name string, fn PresetFunc) *SQLBuilder {
+	return b.addPreset(name, presetConfig{fn: fn, applyByDef: true})
+}
+
+// WithPresetParam задает имя фильтра, через который ApplyFilter применяет пресеты.
+// По умолчанию "preset"
+func (b *SQLBuilder) WithPresetParam(param string) *SQLBuilder {
+	b.presetParam = param
+	return b
+}
+
+func (b *SQLBuilder) addPreset(name string, preset presetConfig) *SQLBuilder {
+	if _, exists := b.presets[name]; exists {
+		b.addConfigError(fmt.Errorf("sqlist: preset %q is already configured", name))
+		return b
+	}
+
+	if b.presets == nil {
+		b.presets = make(map[string]presetConfig)
+	}
+	b.presets[name] = preset
+	b.presetOrder = append(b.presetOrder, name)
+
+	return b
+}
+
+// ApplyPreset применяет пресеты по именам. Неизвестное имя - ошибка
+func (b *SQLBuilder) ApplyPreset(names ...string) *SQLBuilder {
+	for _, name := range splitValues(names) {
+		preset, ok := b.presets[name]
+		if !ok {
+			b.addError(fmt.Errorf("sqlist: unknown preset %q", name))
+			return b
+		}
+
+		if slices.Contains(b.appliedPresets, name) {
+			continue
+		}
+		b.appliedPresets = append(b.appliedPresets, name)
+
+		if condition := preset.fn(b); condition != nil {
+			b.whereConditions = append(b.whereConditions, condition)
+		}
+	}
+
+	return b
+}
+
+// WithoutDefaultPresets отключает пресеты по умолчанию в этом запросе
+// (например, администратору нужны и удаленные записи). Без имен отключает все
+func (b *SQLBuilder) WithoutDefaultPresets(names ...string) *SQLBuilder {
+	if len(names) == 0 {
+		names = b.presetOrder
+	}
+	b.skippedPresets = append(b.skippedPresets, names...)
+	return b
+}
+
+// defaultPresetConditions возвращает условия пресетов по умолчанию, не отключенных
+// и не примененных явно
+func (b *SQLBuilder) defaultPresetConditions() []sq.Sqlizer {
+	var conditions []sq.Sqlizer
+	for _, name := range b.presetOrder {
+		preset := b.presets[name]
+		if !preset.applyByDef || slices.Contains(b.skippedPresets, name) || slices.Contains(b.appliedPresets, name) {
+			continue
+		}
+		if condition := preset.fn(b); condition != nil {
+			conditions = append(conditions, condition)
+		}
+	}
+	return conditions
+}
+
+// Now возвращает текущее время с учетом WithClock и WithLocation
+func (b *SQLBuilder) Now() time.Time {
+	return b.now()
+}
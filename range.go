@@ -0,0 +1,79 @@
+package sqlist
+
+import (
+	"fmt"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// rangeSeparator разделяет границы диапазона: "10..100", "..100", "10.."
+const rangeSeparator = ".."
+
+// rangeValue границы диапазона из значения фильтра.
+// По умолчанию нижняя граница включается, верхняя нет: "a..b" означает [a, b).
+// Скобки задают границы явно: "[a..b]", "(a..b)", "(a..b]"
+type rangeValue struct {
+	lower, upper                   string
+	lowerInclusive, upperInclusive bool
+}
+
+// parseRange разбирает значение фильтра RANGE
+func parseRange(value string) (rangeValue, error) {
+	r := rangeValue{lowerInclusive: true}
+
+	body := value
+	if strings.HasPrefix(body, "[") || strings.HasPrefix(body, "(") {
+		r.lowerInclusive = body[0] == '['
+		body = body[1:]
+	}
+	if strings.HasSuffix(body, "]") || strings.HasSuffix(body, ")") {
+		r.upperInclusive = body[len(body)-1] == ']'
+		body = body[:len(body)-1]
+	}
+
+	lower, upper, ok := strings.Cut(body, rangeSeparator)
+	if !ok {
+		return r, fmt.Errorf("sqlist: invalid range %q: expected lower..upper", value)
+	}
+
+	r.lower, r.upper = strings.TrimSpace(lower), strings.TrimSpace(upper)
+	if r.lower == "" && r.upper == "" {
+		return r, fmt.Errorf("sqlist: invalid range %q: both bounds are empty", value)
+	}
+
+	return r, nil
+}
+
+// rangeCondition строит пару условий >=/> и </<= по границам диапазона для колонки column
+func (b *SQLBuilder) rangeCondition(column string, cfg FieldConfig, value string) (sq.Sqlizer, error) {
+	r, err := parseRange(value)
+	if err != nil {
+		return nil, err
+	}
+
+	lowerOp, upperOp := GT, LT
+	if r.lowerInclusive {
+		lowerOp = GTE
+	}
+	if r.upperInclusive {
+		upperOp = LTE
+	}
+
+	conditions := sq.And{}
+	for _, bound := range []struct {
+		op    Op
+		value string
+	}{{lowerOp, r.lower}, {upperOp, r.upper}} {
+		if bound.value == "" {
+			continue
+		}
+		condition, err := b.comparison(column, cfg, bound.op, bound.value)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+
+	return conditions, nil
+}
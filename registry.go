@@ -0,0 +1,107 @@
+package sqlist
+
+import (
+	"context"
+	"sync"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// OpFunc строит условие фильтра для колонки column по значениям из запроса.
+// Возвращенный nil означает, что фильтр не добавляет условий
+type OpFunc func(column string, values []string, cfg FieldConfig) (sq.Sqlizer, error)
+
+// OpEnvFunc оператор, которому нужно окружение билдера: диалект, часы, часовой пояс, контекст
+type OpEnvFunc func(env OpEnv, column string, values []string, cfg FieldConfig) (sq.Sqlizer, error)
+
+// OpEnv окружение билдера, применяющего фильтр. Нулевое значение - окружение билдера по умолчанию
+type OpEnv struct {
+	b *SQLBuilder
+}
+
+// registry глобальный реестр операторов, используемых ApplyFilter
+var registry = struct {
+	sync.RWMutex
+	ops map[Op]OpEnvFunc
+}{ops: make(map[Op]OpEnvFunc)}
+
+// RegisterOp регистрирует оператор для всех билдеров. Повторная регистрация заменяет оператор,
+// в том числе встроенный. Имя - строка или Op. Регистрировать операторы стоит при инициализации приложения
+func RegisterOp[N ~string](name N, fn OpFunc) {
+	registerOp(Op(name), fn.withEnv())
+}
+
+// RegisterOpEnv регистрирует оператор, получающий окружение билдера, см. RegisterOp
+func RegisterOpEnv[N ~string](name N, fn OpEnvFunc) {
+	registerOp(Op(name), fn)
+}
+
+// registerOp добавляет оператор в глобальный реестр
+func registerOp(name Op, fn OpEnvFunc) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	registry.ops[name] = fn
+}
+
+// WithOp переопределяет оператор только для этого билдера
+func (b *SQLBuilder) WithOp(name Op, fn OpFunc) *SQLBuilder {
+	return b.WithOpEnv(name, fn.withEnv())
+}
+
+// WithOpEnv переопределяет для этого билдера оператор, получающий окружение билдера
+func (b *SQLBuilder) WithOpEnv(name Op, fn OpEnvFunc) *SQLBuilder {
+	if b.ops == nil {
+		b.ops = make(map[Op]OpEnvFunc)
+	}
+	b.ops[name] = fn
+	return b
+}
+
+// lookupOp ищет оператор сначала среди переопределенных в билдере, затем в глобальном реестре
+func (b *SQLBuilder) lookupOp(name Op) (OpEnvFunc, bool) {
+	if fn, ok := b.ops[name]; ok {
+		return fn, true
+	}
+
+	registry.RLock()
+	defer registry.RUnlock()
+
+	fn, ok := registry.ops[name]
+	return fn, ok
+}
+
+// withEnv приводит оператор к виду с окружением, которое ему не нужно
+func (fn OpFunc) withEnv() OpEnvFunc {
+	return func(_ OpEnv, column string, values []string, cfg FieldConfig) (sq.Sqlizer, error) {
+		return fn(column, values, cfg)
+	}
+}
+
+// builder возвращает билдер окружения или билдер по умолчанию
+func (e OpEnv) builder() *SQLBuilder {
+	if e.b == nil {
+		return NewSQLBuilder()
+	}
+	return e.b
+}
+
+// Dialect возвращает диалект билдера
+func (e OpEnv) Dialect() Dialect {
+	return e.builder().dialect
+}
+
+// Context возвращает контекст запроса билдера
+func (e OpEnv) Context() context.Context {
+	return e.builder().Context()
+}
+
+// ParseValue приводит значение к типу поля с учетом часового пояса и часов билдера
+func (e OpEnv) ParseValue(cfg FieldConfig, value string) (interface{}, error) {
+	return e.builder().parseValue(cfg, value)
+}
+
+// ParseValues приводит значения к типизированному срезу по типу поля
+func (e OpEnv) ParseValues(cfg FieldConfig, values []string) (interface{}, error) {
+	return e.builder().parseValues(cfg, values)
+}
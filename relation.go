@@ -0,0 +1,194 @@
+package sqlist
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// relationCount псевдо-поле связи для фильтра по количеству строк: "orders.count[gte]=3"
+const relationCount = "count"
+
+type (
+	// relationConfig связанная таблица, фильтры по которой превращаются в EXISTS
+	relationConfig struct {
+		Table     string // "orders o"
+		Condition string // условие корреляции с основной таблицей: "o.user_id = u.id"
+	}
+
+	// relationFilter условия по связи в рамках запроса.
+	// Условия одной связи проверяются в одном подзапросе: "есть заказ, который оплачен и больше 100"
+	relationFilter struct {
+		relation   relationConfig
+		conditions []sq.Sqlizer
+		counts     []relationCountFilter
+		negate     bool
+	}
+
+	// relationCountFilter условие на количество связанных строк: COUNT(*) >= 3
+	relationCountFilter struct {
+		operator string
+		value    int64
+		negate   bool
+	}
+)
+
+// Relation помечает поле как поле связанной таблицы (см. WithRelation):
+// фильтр по нему проверяется подзапросом EXISTS, а не через JOIN
+func Relation(name string) FieldOption {
+	return func(cfg *FieldConfig) {
+		cfg.Relation = name
+	}
+}
+
+// WithRelation регистрирует связанную таблицу для фильтров через EXISTS.
+// Пример: WithRelation("orders", "orders o", "o.user_id = u.id")
+//
+// Фильтры:
+//   - поле с опцией Relation("orders"): EXISTS (SELECT 1 FROM orders o WHERE o.user_id = u.id AND ...);
+//     с модификатором [not] - NOT EXISTS (...)
+//   - "orders" = true/false: есть ли вообще связанные строки
+//   - "orders.count[gte]" = 3: количество связанных строк с учетом остальных фильтров по связи
+func (b *SQLBuilder) WithRelation(name, table, condition string) *SQLBuilder {
+	if _, exists := b.relations[name]; exists {
+		b.addConfigError(fmt.Errorf("sqlist: relation %q is already configured", name))
+		return b
+	}
+
+	if b.relations == nil {
+		b.relations = make(map[string]relationConfig)
+	}
+	b.relations[name] = relationConfig{Table: table, Condition: condition}
+
+	return b
+}
+
+// applyRelationFilter применяет фильтры по самой связи: наличие строк и их количество.
+// Фильтры по неизвестным полям игнорируются
+func (b *SQLBuilder) applyRelationFilter(field string, op Op, negate bool, value string) *SQLBuilder {
+	name, pseudo, _ := strings.Cut(field, ".")
+	if _, ok := b.relations[name]; !ok {
+		return b
+	}
+
+	switch pseudo {
+	case "":
+		exists, err := strconv.ParseBool(value)
+		if err != nil {
+			b.addError(fmt.Errorf("sqlist: invalid value %q for relation %q", value, name))
+			return b
+		}
+		b.relationFilter(name, exists == negate)
+
+	case relationCount:
+		count, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			b.addError(fmt.Errorf("sqlist: invalid count %q for relation %q", value, name))
+			return b
+		}
+
+		if op == "" {
+			op = EQ
+		}
+		if negated, ok := negatedOps[op]; ok && negate {
+			op, negate = negated, false
+		}
+
+		operators := map[Op]string{EQ: "=", NOT_EQ: "<>", GT: ">", GTE: ">=", LT: "<", LTE: "<="}
+		operator, ok := operators[op]
+		if !ok {
+			b.addError(fmt.Errorf("sqlist: operator %q is not supported for %q", op, field))
+			return b
+		}
+
+		filter := b.relationFilter(name, false)
+		filter.counts = append(filter.counts, relationCountFilter{operator: operator, value: count, negate: negate})
+	}
+
+	return b
+}
+
+// addRelationCondition добавляет условие фильтра по полю связи.
+// Отрицательные условия проверяются отдельными NOT EXISTS
+func (b *SQLBuilder) addRelationCondition(name string, negate bool, conditions ...sq.Sqlizer) {
+	if _, ok := b.relations[name]; !ok {
+		b.addError(fmt.Errorf("sqlist: unknown relation %q", name))
+		return
+	}
+
+	if negate {
+		filter := &relationFilter{relation: b.relations[name], conditions: conditions, negate: true}
+		b.whereConditions = append(b.whereConditions, filter)
+		return
+	}
+
+	filter := b.relationFilter(name, false)
+	filter.conditions = append(filter.conditions, conditions...)
+}
+
+// relationFilter возвращает общий подзапрос связи, при первом обращении добавляя его в WHERE.
+// С negate создается отдельный NOT EXISTS
+func (b *SQLBuilder) relationFilter(name string, negate bool) *relationFilter {
+	if negate {
+		filter := &relationFilter{relation: b.relations[name], negate: true}
+		b.whereConditions = append(b.whereConditions, filter)
+		return filter
+	}
+
+	if filter, ok := b.relationFilters[name]; ok {
+		return filter
+	}
+
+	if b.relationFilters == nil {
+		b.relationFilters = make(map[string]*relationFilter)
+	}
+	filter := &relationFilter{relation: b.relations[name]}
+	b.relationFilters[name] = filter
+	b.whereConditions = append(b.whereConditions, filter)
+
+	return filter
+}
+
+// ToSql строит EXISTS или условия на количество связанных строк
+func (f *relationFilter) ToSql() (string, []interface{}, error) {
+	subquery := func(column string) sq.SelectBuilder {
+		query := sq.Select(column).From(f.relation.Table).Where(f.relation.Condition)
+		for _, condition := range f.conditions {
+			query = query.Where(condition)
+		}
+		return query
+	}
+
+	if len(f.counts) == 0 {
+		sql, args, err := subquery("1").ToSql()
+		if err != nil {
+			return "", nil, err
+		}
+
+		prefix := "EXISTS ("
+		if f.negate {
+			prefix = "NOT EXISTS ("
+		}
+		return prefix + sql + ")", args, nil
+	}
+
+	count, countArgs, err := subquery("COUNT(*)").ToSql()
+	if err != nil {
+		return "", nil, err
+	}
+
+	parts := make([]string, 0, len(f.counts))
+	var args []interface{}
+	for _, condition := range f.counts {
+		part := "(" + count + ") " + condition.operator + " ?"
+		if condition.negate {
+			part = "NOT (" + part + ")"
+		}
+		parts = append(parts, part)
+		args = append(append(args, countArgs...), condition.value)
+	}
+
+	return strings.Join(parts, " AND "), args, nil
+}
@@ -0,0 +1,91 @@
+package sqlist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// ErrScopeNotSatisfied возвращается build-методами, если обязательное ограничение
+// (например, tenant_id) не удалось получить из контекста запроса
+var ErrScopeNotSatisfied = errors.New("sqlist: required scope is not satisfied")
+
+type (
+	// ScopeFunc строит обязательное условие из контекста запроса.
+	// Ошибка или nil означают, что ограничение не выполнено и запрос строить нельзя
+	ScopeFunc func(ctx context.Context) (sq.Sqlizer, error)
+
+	// scopeConfig обязательное ограничение
+	scopeConfig struct {
+		name string
+		fn   ScopeFunc
+	}
+)
+
+// NewSQLBuilderWithContext создает билдер для запроса с контекстом,
+// из которого обязательные ограничения берут свои значения
+func NewSQLBuilderWithContext(ctx context.Context) *SQLBuilder {
+	b := NewSQLBuilder()
+	b.ctx = ctx
+	return b
+}
+
+// NewRequestWithContext возвращает билдер для одного запроса с контекстом
+func (d *ListDefinition) NewRequestWithContext(ctx context.Context) *SQLBuilder {
+	b := d.NewRequest()
+	b.ctx = ctx
+	return b
+}
+
+// Context возвращает контекст запроса
+func (b *SQLBuilder) Context() context.Context {
+	if b.ctx == nil {
+		return context.Background()
+	}
+	return b.ctx
+}
+
+// WithRequiredScope регистрирует обязательное ограничение. Оно добавляется в каждый запрос
+// при построении, поэтому его не отменяют Reset, фильтры и WithoutDefaultPresets.
+// Если ограничение не выполнено, build-методы возвращают ErrScopeNotSatisfied
+func (b *SQLBuilder) WithRequiredScope(name string, fn ScopeFunc) *SQLBuilder {
+	for _, scope := range b.scopes {
+		if scope.name == name {
+			b.addConfigError(fmt.Errorf("sqlist: scope %q is already configured", name))
+			return b
+		}
+	}
+
+	b.scopes = append(b.scopes, scopeConfig{name: name, fn: fn})
+	return b
+}
+
+// ContextScope ограничение "column = значение из контекста по ключу key",
+// например, tenant_id. Отсутствие значения в контексте - ошибка
+func ContextScope(column string, key any) ScopeFunc {
+	return func(ctx context.Context) (sq.Sqlizer, error) {
+		value := ctx.Value(key)
+		if value == nil {
+			return nil, fmt.Errorf("no value for %v in context", key)
+		}
+		return sq.Eq{column: value}, nil
+	}
+}
+
+// scopeConditions строит условия обязательных ограничений
+func (b *SQLBuilder) scopeConditions() ([]sq.Sqlizer, error) {
+	conditions := make([]sq.Sqlizer, 0, len(b.scopes))
+	for _, scope := range b.scopes {
+		condition, err := scope.fn(b.Context())
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrScopeNotSatisfied, scope.name, err)
+		}
+		if condition == nil {
+			return nil, fmt.Errorf("%w: %q", ErrScopeNotSatisfied, scope.name)
+		}
+		conditions = append(conditions, condition)
+	}
+	return conditions, nil
+}
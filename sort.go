@@ -0,0 +1,291 @@
+package sqlist
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// sortKey ключ сортировки: выражение ORDER BY и вычисление его значения по курсору
+type sortKey struct {
+	expr      string
+	args      []interface{}
+	order     string
+	desc      bool
+	aggregate bool                                     // выражение - агрегат, условие курсора идет в HAVING
+	value     func(cursor map[string]any) (any, error) // значение выражения для строки курсора
+}
+
+// pinConfig закрепление строк в начале списка
+type pinConfig struct {
+	column string
+	ids    []any // пусто - column булева колонка
+}
+
+// SortOrder задает порядок значений перечисления при сортировке по полю,
+// например critical, high, normal, low. Значения вне списка идут последними
+func SortOrder(values ...string) FieldOption {
+	return func(cfg *FieldConfig) {
+		cfg.SortValues = append(cfg.SortValues, values...)
+	}
+}
+
+// WithSortField регистрирует поле, доступное только для сортировки, например агрегат по связи.
+// С опцией Relation выражение expr вычисляется коррелированным подзапросом по связанной таблице:
+// WithSortField("orders_count", "COUNT(*)", Relation("orders")) сортирует по
+// (SELECT COUNT(*) FROM orders o WHERE o.user_id = u.id). Подзапрос и JOIN поля (см. Joins)
+// попадают в запрос, только когда по полю сортируют, и не влияют на BuildCount
+func (b *SQLBuilder) WithSortField(alias, expr string, opts ...FieldOption) *SQLBuilder {
+	if _, exists := b.sortFields[alias]; exists {
+		b.addConfigError(fmt.Errorf("sqlist: sort field %q is already configured", alias))
+		return b
+	}
+
+	if b.sortFields == nil {
+		b.sortFields = make(map[string]FieldConfig)
+	}
+	b.sortFields[alias] = newFieldConfig(expr, "", opts)
+
+	return b
+}
+
+// sortFieldExpr возвращает выражение сортировки поля из WithSortField
+func (b *SQLBuilder) sortFieldExpr(cfg FieldConfig) (string, error) {
+	if cfg.Relation == "" {
+		return cfg.DBField, nil
+	}
+
+	relation, ok := b.relations[cfg.Relation]
+	if !ok {
+		return "", fmt.Errorf("sqlist: unknown relation %q", cfg.Relation)
+	}
+	return "(SELECT " + cfg.DBField + " FROM " + relation.Table + " WHERE " + relation.Condition + ")", nil
+}
+
+// SortRandom устанавливает случайный, но воспроизводимый порядок: одинаковый seed дает
+// одинаковый порядок, поэтому строки не повторяются и не теряются между страницами (в том числе
+// при курсорной пагинации, где в курсоре нужно значение column). column - уникальная колонка.
+// PostgreSQL: md5(id::text || seed), MySQL: MD5(CONCAT(id, seed)).
+// В SQLite нет md5: используется перестановка (id % p * a + b) % p с a и b из seed, id должен быть целым
+func (b *SQLBuilder) SortRandom(column, seed string) *SQLBuilder {
+	b.sort = SortConfig{Order: "ASC", alias: column}
+
+	switch b.dialect {
+	case MySQL:
+		b.sort.Field, b.sort.args = "MD5(CONCAT("+column+", ?))", []interface{}{seed}
+		b.sort.key = func(value any) any { return md5Hex(fmt.Sprint(value) + seed) }
+
+	case SQLite:
+		a, c := randomCoefficients(seed)
+		b.sort.Field = fmt.Sprintf("(%s %% %d * ? + ?) %% %d", column, randomModulus, randomModulus)
+		b.sort.args = []interface{}{a, c}
+		b.sort.key = func(value any) any {
+			id, err := strconv.ParseInt(fmt.Sprint(value), 10, 64)
+			if err != nil {
+				return value
+			}
+			return (id%randomModulus*a + c) % randomModulus
+		}
+
+	default:
+		b.sort.Field, b.sort.args = "md5("+column+"::text || ?)", []interface{}{seed}
+		b.sort.key = func(value any) any { return md5Hex(fmt.Sprint(value) + seed) }
+	}
+
+	return b
+}
+
+// randomModulus простой модуль перестановки SortRandom для SQLite (2^31 - 1)
+const randomModulus = 2147483647
+
+// randomCoefficients выводит из seed коэффициенты перестановки (id * a + b) % p
+func randomCoefficients(seed string) (int64, int64) {
+	h := fnv.New64a()
+	h.Write([]byte(seed))
+	sum := h.Sum64()
+
+	a := int64(sum>>32)%(randomModulus-1) + 1
+	c := int64(sum&0xffffffff) % randomModulus
+	return a, c
+}
+
+// md5Hex возвращает md5 строки в шестнадцатеричном виде, как md5() в PostgreSQL и MySQL
+func md5Hex(value string) string {
+	sum := md5.Sum([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// WithTieBreaker добавляет в конец сортировки уникальную колонку (обычно первичный ключ),
+// чтобы порядок строк был однозначным. Нужен для курсорной пагинации, см. After
+func (b *SQLBuilder) WithTieBreaker(column string) *SQLBuilder {
+	b.tieBreaker = column
+	return b
+}
+
+// PinFirst закрепляет в начале списка строки, у которых булева колонка column истинна
+func (b *SQLBuilder) PinFirst(column string) *SQLBuilder {
+	b.pin = &pinConfig{column: column}
+	return b
+}
+
+// PinIDs закрепляет в начале списка строки, у которых column входит в ids
+func (b *SQLBuilder) PinIDs(column string, ids ...any) *SQLBuilder {
+	if len(ids) > 0 {
+		b.pin = &pinConfig{column: column, ids: ids}
+	}
+	return b
+}
+
+// After включает курсорную пагинацию: выбираются строки после строки курсора в порядке сортировки.
+// Курсор содержит значения последней строки страницы: поля сортировки по алиасу, колонки
+// закрепления и WithTieBreaker по имени колонки
+func (b *SQLBuilder) After(cursor map[string]any) *SQLBuilder {
+	b.cursor = cursor
+	return b
+}
+
+// sortKeys возвращает ключи сортировки: закрепление, сортировка запроса, уникальная колонка
+func (b *SQLBuilder) sortKeys() []sortKey {
+	var keys []sortKey
+
+	if b.pin != nil {
+		keys = append(keys, b.pinKey())
+	}
+
+	if b.sort.Field != "" {
+		sort := b.sort
+		keys = append(keys, sortKey{
+			expr:      sort.Field,
+			args:      sort.args,
+			order:     sort.Order,
+			desc:      strings.EqualFold(strings.TrimSpace(sort.Order), "DESC"),
+			aggregate: sort.aggregate,
+			value: func(cursor map[string]any) (any, error) {
+				value, err := cursorValue(cursor, sort.alias)
+				if err != nil || sort.key == nil {
+					return value, err
+				}
+				return sort.key(value), nil
+			},
+		})
+	}
+
+	if b.tieBreaker != "" {
+		column := b.tieBreaker
+		keys = append(keys, sortKey{
+			expr:  column,
+			order: "ASC",
+			value: func(cursor map[string]any) (any, error) {
+				return cursorValue(cursor, column)
+			},
+		})
+	}
+
+	return keys
+}
+
+// pinKey строит ключ закрепления: 0 у закрепленных строк, 1 у остальных
+func (b *SQLBuilder) pinKey() sortKey {
+	pin := *b.pin
+
+	expr := "CASE WHEN " + pin.column + " THEN 0 ELSE 1 END"
+	if len(pin.ids) > 0 {
+		expr = "CASE WHEN " + pin.column + " IN (" + sq.Placeholders(len(pin.ids)) + ") THEN 0 ELSE 1 END"
+	}
+
+	return sortKey{
+		expr:  expr,
+		args:  pin.ids,
+		order: "ASC",
+		value: func(cursor map[string]any) (any, error) {
+			value, err := cursorValue(cursor, pin.column)
+			if err != nil {
+				return nil, err
+			}
+
+			pinned := slices.ContainsFunc(pin.ids, func(id any) bool {
+				return fmt.Sprint(id) == fmt.Sprint(value)
+			})
+			if len(pin.ids) == 0 {
+				pinned = value == true
+			}
+			if pinned {
+				return 0, nil
+			}
+			return 1, nil
+		},
+	}
+}
+
+// enumExpr строит выражение позиции значения колонки в списке values
+func enumExpr(column string, values []string) (string, []interface{}) {
+	var expr strings.Builder
+	args := make([]interface{}, 0, len(values))
+
+	expr.WriteString("CASE " + column)
+	for i, value := range values {
+		fmt.Fprintf(&expr, " WHEN ? THEN %d", i)
+		args = append(args, value)
+	}
+	fmt.Fprintf(&expr, " ELSE %d END", len(values))
+
+	return expr.String(), args
+}
+
+// enumRank возвращает позицию значения в списке values, как ее вычисляет enumExpr
+func enumRank(values []string, value any) int {
+	if i := slices.Index(values, fmt.Sprint(value)); i >= 0 {
+		return i
+	}
+	return len(values)
+}
+
+// cursorValue возвращает значение курсора по имени
+func cursorValue(cursor map[string]any, name string) (any, error) {
+	value, ok := cursor[name]
+	if !ok {
+		return nil, fmt.Errorf("sqlist: cursor has no value for %q", name)
+	}
+	return value, nil
+}
+
+// keysetCondition строит условие "строка после курсора" по ключам сортировки:
+// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ...
+func keysetCondition(keys []sortKey, cursor map[string]any) (sq.Sqlizer, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("sqlist: cursor pagination requires sort")
+	}
+
+	values := make([]any, len(keys))
+	for i, key := range keys {
+		value, err := key.value(cursor)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+
+	condition := make(sq.Or, 0, len(keys))
+	for i, key := range keys {
+		step := make(sq.And, 0, i+1)
+		for j, prev := range keys[:i] {
+			step = append(step, sq.Expr(prev.expr+" = ?", slices.Concat(prev.args, []any{values[j]})...))
+		}
+
+		op := " > ?"
+		if key.desc {
+			op = " < ?"
+		}
+		step = append(step, sq.Expr(key.expr+op, slices.Concat(key.args, []any{values[i]})...))
+
+		condition = append(condition, step)
+	}
+
+	return condition, nil
+}
@@ -1,6 +1,9 @@
 package sqlist
 
 import (
+	"context"
+	"time"
+
 	sq "github.com/Masterminds/squirrel"
 )
 
@@ -25,37 +28,100 @@ type (
 	SQLBuilder struct {
 		// Конфигурация
 		fromTable     string
+		fromSubquery  *SQLBuilder // билдер-источник FROM, fromTable - его алиас, см. WithFromSubquery
 		estimateTable string
 		fields        []string
+		selectFields  map[string]FieldConfig // поля, выбираемые клиентом (алиас -> выражение)
+		selectOrder   []string
+		relations     map[string]relationConfig // связанные таблицы для фильтров через EXISTS
+		sortFields    map[string]FieldConfig    // поля только для сортировки, см. WithSortField
+		presets       map[string]presetConfig   // именованные пресеты фильтров
+		presetOrder   []string
+		presetParam   string
+		scopes        []scopeConfig // обязательные ограничения, см. WithRequiredScope
+		ctx           context.Context
+		permissions   []string // права текущего запроса
 		joins         []joinConfig
+		groupBy       []string // выражения GROUP BY, см. WithGroupBy
+		groupJoins    []string // именованные JOIN выражений GROUP BY, см. WithGroupByJoins
+		tieBreaker    string   // уникальная колонка в конце сортировки, см. WithTieBreaker
 		placeholder   sq.PlaceholderFormat
+		dialect       Dialect
 		fieldConfigs  map[string]FieldConfig
+		// дополнительные операторы полей в режиме FieldConfigMulti
+		fieldVariants   map[string][]FieldConfig
+		fieldConfigMode FieldConfigMode
+		duplicateFields []string         // повторно настроенные поля, см. Validate
+		configErr       error            // ошибки конфигурации, не сбрасываются Reset
+		ops             map[Op]OpEnvFunc // операторы, переопределенные для этого билдера
+		clock           func() time.Time // источник текущего времени для относительных дат
+		location        *time.Location   // часовой пояс пользователя
+		nullToken       string           // значение фильтра, означающее IS NULL
+		notNullToken    string           // значение фильтра, означающее IS NOT NULL
 
 		// Состояние (все условия как Sqlizer)
-		whereConditions []sq.Sqlizer
-		sort            SortConfig
-		limit           uint64
-		offset          uint64
+		whereConditions  []sq.Sqlizer
+		havingConditions []sq.Sqlizer // фильтры по полям-агрегатам
+		sort             SortConfig
+		pin              *pinConfig      // закрепленные строки, см. PinFirst
+		cursor           map[string]any  // курсор пагинации, см. After
+		requestedFields  []string        // поля, запрошенные через ApplyFields
+		filterJoins      map[string]bool // ленивые JOIN, нужные активным фильтрам
+		relationFilters  map[string]*relationFilter
+		appliedPresets   []string
+		skippedPresets   []string // отключенные в запросе пресеты по умолчанию
+		limit            uint64
+		offset           uint64
+		maxLimit         uint64 // ограничение сверху для Limit и Page, 0 - без ограничения
+
+		// Ошибка, накопленная при конфигурации и применении фильтров.
+		// Возвращается из build-методов
+		err error
 	}
 
 	// FieldConfig описывает как обрабатывать поле
 	FieldConfig struct {
-		DBField  string // поле в БД
-		Operator Op     // "eq", "like", "ilike", "gt", "lt"
+		DBField  string    // поле в БД
+		Operator Op        // "eq", "like", "ilike", "gt", "lt"
+		Type     ValueType // тип значения, к которому приводится фильтр
+		Nullable bool      // значения-маркеры null/!null превращаются в IS NULL/IS NOT NULL
+
+		Always bool     // поле выборки включается всегда, см. AlwaysSelected
+		Joins  []string // именованные JOIN, нужные полю, см. Joins
+
+		Relation  string // связь, фильтр по полю проверяется через EXISTS, см. Relation
+		Aggregate bool   // поле-агрегат, фильтр по нему попадает в HAVING, см. Aggregate
+
+		SortValues []string // порядок значений при сортировке, см. SortOrder
+
+		Permissions []string // права, нужные для фильтра, сортировки и выборки
+		Masked      bool     // поле выборки без прав выбирается как NULL, см. Masked
+
+		ValueExpr string        // шаблон правой части для EXPR_*, например "lower(?)"
+		ExprArgs  []interface{} // аргументы плейсхолдеров в DBField
 	}
 
 	// joinConfig использует Sqlizer для условия
 	joinConfig struct {
+		Name      string // имя ленивого JOIN, пустое у обычных
 		Type      string // "JOIN", "LEFT JOIN", "RIGHT JOIN"
-		Table     string
+		Table     string // таблица или алиас подзапроса LATERAL
 		Condition string
-		Args      interface{}
+		Args      []interface{} // аргументы плейсхолдеров в Condition
+		Subquery  sq.Sqlizer    // подзапрос LATERAL, см. WithLateralJoin
+		DependsOn []string      // ленивые JOIN, которые должны идти раньше
 	}
 
 	// SortConfig сортировка
 	SortConfig struct {
 		Field string
 		Order string
+
+		alias     string              // поле, переданное в Sort
+		args      []interface{}       // аргументы выражения сортировки
+		key       func(value any) any // значение выражения сортировки по значению поля в курсоре
+		joins     []string            // ленивые JOIN, нужные для сортировки
+		aggregate bool                // сортировка по агрегату сгруппированного списка
 	}
 
 	// BuildResult результат построения запроса
@@ -69,15 +135,39 @@ type (
 )
 
 const (
-	EQ      Op = "eq"    // =
-	NOT_EQ  Op = "neq"   // !=
-	LIKE    Op = "like"  // like
-	ILIKE   Op = "ilike" // ilike
-	GT      Op = "gt"    // >
-	LT      Op = "lt"    // <
-	GTE     Op = "gte"   // >=
-	LTE     Op = "lte"   // <=
-	EXPR_EQ Op = "expr"  // just expression
+	EQ        Op = "eq"     // =
+	NOT_EQ    Op = "neq"    // !=
+	LIKE      Op = "like"   // like
+	NOT_LIKE  Op = "nlike"  // not like
+	ILIKE     Op = "ilike"  // ilike
+	NOT_ILIKE Op = "nilike" // not ilike
+	IN        Op = "in"     // in (значения через запятую)
+	NOT_IN    Op = "nin"    // not in
+	GT        Op = "gt"     // >
+	LT        Op = "lt"     // <
+	GTE       Op = "gte"    // >=
+	LTE       Op = "lte"    // <=
+
+	EXPR_EQ     Op = "expr"       // just expression
+	EXPR_NOT_EQ Op = "expr_neq"   // выражение <> выражение
+	EXPR_GT     Op = "expr_gt"    // выражение > выражение
+	EXPR_LT     Op = "expr_lt"    // выражение < выражение
+	EXPR_GTE    Op = "expr_gte"   // выражение >= выражение
+	EXPR_LTE    Op = "expr_lte"   // выражение <= выражение
+	EXPR_LIKE   Op = "expr_like"  // выражение LIKE выражение
+	EXPR_ILIKE  Op = "expr_ilike" // выражение ILIKE выражение
+	EXPR_IN     Op = "expr_in"    // выражение IN (выражение, ...)
+
+	ARRAY_CONTAINS     Op = "array_contains"     // @> колонка содержит все значения
+	ARRAY_OVERLAPS     Op = "array_overlaps"     // && колонка содержит хотя бы одно значение
+	ARRAY_CONTAINED_BY Op = "array_contained_by" // <@ все элементы колонки входят в значения
+	ANY_EQ             Op = "any_eq"             // = ANY(?) колонка равна одному из значений
+
+	RANGE     Op = "range"  // >= lower AND < upper, значение "lower..upper"
+	NOT_RANGE Op = "nrange" // NOT (>= lower AND < upper)
+
+	IS_NULL     Op = "is_null"     // IS NULL при true, IS NOT NULL при false
+	IS_NOT_NULL Op = "is_not_null" // IS NOT NULL при true, IS NULL при false
 )
 
 // ============= КОНСТРУКТОР =============
@@ -89,8 +179,12 @@ func NewSQLBuilder() *SQLBuilder {
 		joins:           []joinConfig{},
 		whereConditions: []sq.Sqlizer{},
 		placeholder:     sq.Dollar, // по умолчанию PostgreSQL
+		dialect:         PostgreSQL,
 		limit:           7,
 		offset:          0,
 		fieldConfigs:    make(map[string]FieldConfig),
+		nullToken:       "null",
+		notNullToken:    "!null",
+		presetParam:     defaultPresetParam,
 	}
 }
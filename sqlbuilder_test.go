@@ -1,7 +1,13 @@
 package sqlist
 
 import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/Masterminds/squirrel"
 	sq "github.com/Masterminds/squirrel"
@@ -567,6 +573,7 @@ func TestApplyExpr(t *testing.T) {
 	})
 
 	t.Run("apply expression with no EXPR_EQ", func(t *testing.T) {
+		b := NewSQLBuilder().WithFrom("users")
 		b.WithFieldConfig("snils", "toINT(snils)", EQ)
 
 		b.ApplyExpr("snils", "toINT(?)", 10)
@@ -581,4 +588,2026 @@ func TestApplyExpr(t *testing.T) {
 
 		assert.Equal(t, []any{10}, args)
 	})
+
+	t.Run("args must match placeholders", func(t *testing.T) {
+		b := NewSQLBuilder().WithFrom("users").WithFields("id").
+			WithFieldConfig("snils", "toINT(snils)", EXPR_EQ)
+
+		_, _, err := b.ApplyExpr("snils", "toINT(?, ?)", 10).BuildSelect()
+		assert.ErrorContains(t, err, "expects 2 args, got 1")
+	})
+
+	t.Run("ordinary operator without args", func(t *testing.T) {
+		b := NewSQLBuilder().WithFrom("users").WithFields("id").
+			WithFieldConfig("name", "name", ILIKE).
+			WithFieldConfig("age", "age", RANGE).
+			WithFieldConfig("tags", "tags", ARRAY_CONTAINS)
+
+		sql, args, err := b.ApplyExpr("name", "john").BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT id FROM users WHERE (name ILIKE $1) LIMIT 7", sql)
+		assert.Equal(t, []any{"%john%"}, args)
+
+		sql, args, err = b.Reset().ApplyExpr("age", "18..30").ApplyExpr("tags", "go").BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT id FROM users WHERE (age >= $1 AND age < $2 AND tags @> $3)", sql)
+		assert.Len(t, args, 3)
+	})
+
+	t.Run("filter pipeline", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithFrom("users u").
+			WithFields("u.id").
+			WithLazyLeftJoin("city", "cities c", "c.id = u.city_id").
+			WithRelation("orders", "orders o", "o.user_id = u.id").
+			WithFieldConfig("city", "lower(c.name)", EXPR_EQ, Joins("city")).
+			WithFieldConfig("order_status", "o.status", EQ, Relation("orders")).
+			WithFieldConfig("salary", "u.salary", GTE, Permissions("hr"))
+
+		_, _, err := b.ApplyExpr("salary", "?", 1000).BuildSelect()
+		var permErr *PermissionError
+		require.ErrorAs(t, err, &permErr)
+		assert.Equal(t, "salary", permErr.Field)
+
+		sql, args, err := b.Reset().
+			ApplyExpr("city", "lower(?)", "Moscow").
+			ApplyExpr("order_status", "?", "paid").
+			BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT u.id FROM users u LEFT JOIN cities c ON c.id = u.city_id "+
+			"WHERE (lower(c.name) = lower($1) AND EXISTS (SELECT 1 FROM orders o WHERE o.user_id = u.id AND o.status = $2))", sql)
+		assert.Equal(t, []any{"Moscow", "paid"}, args)
+
+		assert.True(t, b.filtered("city"))
+	})
+
+	t.Run("aggregate goes to having", func(t *testing.T) {
+		sql, args, err := NewSQLBuilder().
+			WithFrom("orders o").
+			WithFields("o.user_id", "SUM(o.total) AS total").
+			WithGroupBy("o.user_id").
+			WithFieldConfig("total", "SUM(o.total)", GTE, Aggregate()).
+			ApplyExpr("total", "?", 100).
+			BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT o.user_id, SUM(o.total) AS total FROM orders o GROUP BY o.user_id HAVING (SUM(o.total) >= $1) LIMIT 7", sql)
+		assert.Equal(t, []any{100}, args)
+	})
+}
+
+func TestArrayOperators(t *testing.T) {
+	t.Run("postgres", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithFrom("posts").
+			WithFields("id").
+			WithFieldConfig("tags", "posts.tags", ARRAY_CONTAINS).
+			WithFieldConfig("any_tag", "posts.tags", ARRAY_OVERLAPS).
+			WithFieldConfig("only_tags", "posts.tags", ARRAY_CONTAINED_BY).
+			WithFieldConfig("status", "posts.status", ANY_EQ)
+
+		b.ApplyFilterValues("tags", "go", "sql")
+		b.ApplyFilter("any_tag", "a,b")
+		b.ApplyFilter("only_tags", "x")
+		b.ApplyFilterValues("status", "new", "done")
+
+		sql, args, err := b.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "posts.tags @> $1")
+		assert.Contains(t, sql, "posts.tags && $2")
+		assert.Contains(t, sql, "posts.tags <@ $3")
+		assert.Contains(t, sql, "posts.status = ANY($4)")
+		assert.Equal(t, []any{[]string{"go", "sql"}, []string{"a", "b"}, []string{"x"}, []string{"new", "done"}}, args)
+	})
+
+	t.Run("mysql", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithDialect(MySQL).
+			WithFrom("posts").
+			WithFields("id").
+			WithFieldConfig("tags", "tags", ARRAY_CONTAINS).
+			WithFieldConfig("status", "status", ANY_EQ)
+
+		b.ApplyFilter("tags", "go,sql")
+		b.ApplyFilter("status", "new,done")
+
+		sql, args, err := b.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "JSON_CONTAINS(tags, ?)")
+		assert.Contains(t, sql, "status IN (?,?)")
+		assert.Equal(t, []any{`["go","sql"]`, "new", "done"}, args)
+	})
+
+	t.Run("unsupported dialect", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithDialect(SQLite).
+			WithFrom("posts").
+			WithFields("id").
+			ArrayOverlaps("tags", []string{"go"})
+
+		_, _, err := b.BuildSelect()
+
+		assert.ErrorIs(t, err, ErrUnsupported)
+	})
+}
+
+func TestRangeFilter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		where string
+		args  []any
+	}{
+		{"default bounds", "10..100", "WHERE (price >= $1 AND price < $2)", []any{int64(10), int64(100)}},
+		{"open lower", "..100", "WHERE (price < $1)", []any{int64(100)}},
+		{"open upper", "10..", "WHERE (price >= $1)", []any{int64(10)}},
+		{"inclusive", "[10..100]", "WHERE (price >= $1 AND price <= $2)", []any{int64(10), int64(100)}},
+		{"exclusive", "(10..100)", "WHERE (price > $1 AND price < $2)", []any{int64(10), int64(100)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewSQLBuilder().
+				WithFrom("goods").
+				WithFields("id").
+				WithFieldConfig("price", "price", RANGE, FieldType(TypeInt))
+
+			b.ApplyFilter("price", tt.value)
+
+			sql, args, err := b.BuildSelect()
+
+			require.NoError(t, err)
+			assert.Contains(t, sql, tt.where)
+			assert.Equal(t, tt.args, args)
+		})
+	}
+
+	t.Run("time bounds", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithFrom("users").
+			WithFields("id").
+			WithFieldConfig("created", "created_at", RANGE, FieldType(TypeTime))
+
+		b.ApplyFilter("created", "2024-01-01..2024-02-01")
+
+		_, args, err := b.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Equal(t, []any{
+			time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		}, args)
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		for _, value := range []string{"10", "..", "a..10"} {
+			b := NewSQLBuilder().
+				WithFrom("goods").
+				WithFieldConfig("price", "price", RANGE, FieldType(TypeInt))
+
+			b.ApplyFilter("price", value)
+
+			_, _, err := b.BuildSelect()
+			assert.Error(t, err, value)
+			assert.Empty(t, b.whereConditions, value)
+		}
+	})
+}
+
+func TestTypedFilterValues(t *testing.T) {
+	b := NewSQLBuilder().
+		WithFrom("users").
+		WithFields("id").
+		WithFieldConfig("age", "age", GTE, FieldType(TypeInt)).
+		WithFieldConfig("ids", "id", ANY_EQ, FieldType(TypeInt))
+
+	b.ApplyFilter("age", "18")
+	b.ApplyFilter("ids", "1,2")
+
+	_, args, err := b.BuildSelect()
+
+	require.NoError(t, err)
+	assert.Equal(t, []any{int64(18), []int64{1, 2}}, args)
+
+	b.ApplyFilter("age", "eighteen")
+	_, _, err = b.BuildSelect()
+	assert.Error(t, err)
+}
+
+func TestRelativeDateFilters(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	// среда, 2024-03-13 01:30 по Москве (2024-03-12 22:30 UTC)
+	clock := func() time.Time { return time.Date(2024, 3, 12, 22, 30, 0, 0, time.UTC) }
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, moscow) }
+
+	tests := []struct {
+		name  string
+		op    Op
+		value string
+		where string
+		args  []any
+	}{
+		{"today", EQ, "today", "(created_at >= $1 AND created_at < $2)", []any{day(2024, 3, 13), day(2024, 3, 14)}},
+		{"this week", EQ, "this_week", "(created_at >= $1 AND created_at < $2)", []any{day(2024, 3, 11), day(2024, 3, 18)}},
+		{"last month", EQ, "last_month", "(created_at >= $1 AND created_at < $2)", []any{day(2024, 2, 1), day(2024, 3, 1)}},
+		{"date only", EQ, "2024-01-05", "(created_at >= $1 AND created_at < $2)", []any{day(2024, 1, 5), day(2024, 1, 6)}},
+		{"not today", NOT_EQ, "today", "(created_at < $1 OR created_at >= $2)", []any{day(2024, 3, 13), day(2024, 3, 14)}},
+		{"lte date", LTE, "2024-01-31", "created_at < $1", []any{day(2024, 2, 1)}},
+		{"gt date", GT, "2024-01-31", "created_at >= $1", []any{day(2024, 2, 1)}},
+		{"relative range", RANGE, "now-7d..now", "created_at >= $1 AND created_at < $2",
+			[]any{clock().In(moscow).AddDate(0, 0, -7), clock().In(moscow)}},
+		{"inclusive date range", RANGE, "[2024-01-01..2024-01-31]", "created_at >= $1 AND created_at < $2",
+			[]any{day(2024, 1, 1), day(2024, 2, 1)}},
+		{"combined offsets", GTE, "now-1M+2h", "created_at >= $1", []any{clock().In(moscow).AddDate(0, -1, 0).Add(2 * time.Hour)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewSQLBuilder().
+				WithFrom("orders").
+				WithFields("id").
+				WithClock(clock).
+				WithLocation(moscow).
+				WithFieldConfig("created", "created_at", tt.op, FieldType(TypeTime))
+
+			b.ApplyFilter("created", tt.value)
+
+			sql, args, err := b.BuildSelect()
+
+			require.NoError(t, err)
+			assert.Contains(t, sql, tt.where)
+			require.Len(t, args, len(tt.args))
+			for i := range args {
+				assert.True(t, tt.args[i].(time.Time).Equal(args[i].(time.Time)), "arg %d: %v != %v", i, tt.args[i], args[i])
+			}
+		})
+	}
+
+	t.Run("invalid expression", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithFrom("orders").
+			WithFieldConfig("created", "created_at", EQ, FieldType(TypeTime))
+
+		b.ApplyFilter("created", "now-7x")
+
+		_, _, err := b.BuildSelect()
+		assert.Error(t, err)
+	})
+}
+
+func TestNullFilters(t *testing.T) {
+	t.Run("null tokens", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithFrom("tasks").
+			WithFields("id").
+			WithFieldConfig("assignee", "assignee_id", EQ, Nullable())
+		b.ApplyFilter("assignee", "null")
+
+		sql, args, err := b.BuildSelect()
+		require.NoError(t, err)
+		assert.Contains(t, sql, "WHERE (assignee_id IS NULL)")
+		assert.Empty(t, args)
+
+		b.Reset().ApplyFilter("assignee", "!null")
+
+		sql, _, err = b.BuildSelect()
+		require.NoError(t, err)
+		assert.Contains(t, sql, "WHERE (assignee_id IS NOT NULL)")
+	})
+
+	t.Run("not nullable field", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithFrom("tasks").
+			WithFields("id").
+			WithFieldConfig("owner", "owner_id", EQ)
+		b.ApplyFilter("owner", "null")
+
+		sql, args, err := b.BuildSelect()
+		require.NoError(t, err)
+		assert.Contains(t, sql, "owner_id = $1")
+		assert.Equal(t, []any{"null"}, args)
+	})
+
+	t.Run("custom tokens", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithFrom("tasks").
+			WithFields("id").
+			WithFieldConfig("assignee", "assignee_id", EQ, Nullable()).
+			WithNullTokens("~", "*")
+		b.ApplyFilter("assignee", "*")
+
+		sql, _, err := b.BuildSelect()
+		require.NoError(t, err)
+		assert.Contains(t, sql, "assignee_id IS NOT NULL")
+	})
+
+	t.Run("is null operator", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithFrom("tasks").
+			WithFields("id").
+			WithFieldConfig("archived", "archived_at", IS_NULL)
+		b.ApplyFilter("archived", "true")
+		sql, _, err := b.BuildSelect()
+		require.NoError(t, err)
+		assert.Contains(t, sql, "archived_at IS NULL")
+
+		b.Reset().ApplyFilter("archived", "0")
+		sql, _, err = b.BuildSelect()
+		require.NoError(t, err)
+		assert.Contains(t, sql, "archived_at IS NOT NULL")
+
+		b.Reset().ApplyFilter("archived", "maybe")
+		_, _, err = b.BuildSelect()
+		assert.Error(t, err)
+	})
+}
+
+func TestNegatedFilters(t *testing.T) {
+	tests := []struct {
+		name  string
+		op    Op
+		key   string
+		value string
+		where string
+		args  []any
+	}{
+		{"not eq", EQ, "f[not]", "archived", "WHERE (col <> $1)", []any{"archived"}},
+		{"not like", LIKE, "f[not]", "test", "WHERE (col NOT LIKE $1)", []any{"test%"}},
+		{"not ilike", ILIKE, "f[not]", "test", "WHERE (col NOT ILIKE $1)", []any{"%test%"}},
+		{"not in", IN, "f[not]", "a,b", "WHERE (col NOT IN ($1,$2))", []any{"a", "b"}},
+		{"in", IN, "f", "a,b", "WHERE (col IN ($1,$2))", []any{"a", "b"}},
+		{"not range", RANGE, "f[not]", "1..5", "WHERE (NOT ((col >= $1 AND col < $2)))", []any{"1", "5"}},
+		{"not range op", NOT_RANGE, "f", "1..5", "WHERE (NOT ((col >= $1 AND col < $2)))", []any{"1", "5"}},
+		{"double negation", NOT_LIKE, "f[not]", "test", "WHERE (col LIKE $1)", []any{"test%"}},
+		{"generic negation", GT, "f[not]", "5", "WHERE (NOT (col > $1))", []any{"5"}},
+		{"array negation", ARRAY_OVERLAPS, "f[not]", "a", "WHERE (NOT (col && $1))", []any{[]string{"a"}}},
+		{"not is null", IS_NULL, "f[not]", "true", "WHERE (col IS NOT NULL)", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewSQLBuilder().
+				WithFrom("t").
+				WithFields("id").
+				WithFieldConfig("f", "col", tt.op)
+
+			b.ApplyFilter(tt.key, tt.value)
+
+			sql, args, err := b.BuildSelect()
+
+			require.NoError(t, err)
+			assert.Contains(t, sql, tt.where)
+			assert.Equal(t, tt.args, args)
+		})
+	}
+
+	t.Run("empty list", func(t *testing.T) {
+		for _, op := range []Op{IN, NOT_IN, ANY_EQ, ARRAY_CONTAINS, EXPR_IN} {
+			for _, key := range []string{"f", "f[not]"} {
+				sql, args, err := NewSQLBuilder().
+					WithFrom("t").
+					WithFields("id").
+					WithFieldConfig("f", "col", op).
+					ApplyFilter(key, " , ").
+					BuildSelect()
+
+				require.NoError(t, err)
+				assert.Equal(t, "SELECT id FROM t LIMIT 7", sql, op)
+				assert.Empty(t, args)
+			}
+		}
+	})
+
+	t.Run("not null token", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithFrom("t").
+			WithFields("id").
+			WithFieldConfig("f", "col", EQ, Nullable())
+
+		b.ApplyFilter("f[not]", "null")
+
+		sql, _, err := b.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "WHERE (col IS NOT NULL)")
+	})
+
+	t.Run("unknown modifier", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithFrom("t").
+			WithFieldConfig("f", "col", EQ)
+
+		b.ApplyFilter("f[maybe]", "x")
+
+		_, _, err := b.BuildSelect()
+
+		assert.Error(t, err)
+	})
+}
+
+func TestOperatorRegistry(t *testing.T) {
+	const phoneEq = "phone_normalized_eq"
+
+	RegisterOp(phoneEq, func(column string, values []string, cfg FieldConfig) (squirrel.Sqlizer, error) {
+		return squirrel.Expr("regexp_replace("+column+", '\\D', '', 'g') = ?", values[0]), nil
+	})
+
+	t.Run("registered operator", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithFrom("users").
+			WithFields("id").
+			WithFieldConfig("phone", "phone", phoneEq)
+
+		b.ApplyFilter("phone", "79991234567")
+
+		sql, args, err := b.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "WHERE (regexp_replace(phone, '\\D', '', 'g') = $1)")
+		assert.Equal(t, []any{"79991234567"}, args)
+	})
+
+	t.Run("operator name from string", func(t *testing.T) {
+		name := "lower_eq"
+		RegisterOpEnv(name, func(env OpEnv, column string, values []string, cfg FieldConfig) (squirrel.Sqlizer, error) {
+			if env.Dialect() == SQLite {
+				return squirrel.Expr(column+" = ? COLLATE NOCASE", values[0]), nil
+			}
+			return squirrel.Expr("lower("+column+") = lower(?)", values[0]), nil
+		})
+
+		sql, _, err := NewSQLBuilder().
+			WithDialect(SQLite).
+			WithFrom("users").
+			WithFields("id").
+			WithFieldConfig("login", "login", Op(name)).
+			ApplyFilter("login", "Admin").
+			BuildSelect()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "WHERE (login = ? COLLATE NOCASE)")
+	})
+
+	t.Run("negated registered operator", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithFrom("users").
+			WithFields("id").
+			WithFieldConfig("phone", "phone", phoneEq)
+
+		b.ApplyFilter("phone[not]", "1")
+
+		sql, _, err := b.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "WHERE (NOT (regexp_replace(phone, '\\D', '', 'g') = $1))")
+	})
+
+	t.Run("per-builder override", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithFrom("users").
+			WithFields("id").
+			WithFieldConfig("name", "name", ILIKE).
+			WithOp(ILIKE, func(column string, values []string, cfg FieldConfig) (squirrel.Sqlizer, error) {
+				return squirrel.Expr("lower("+column+") = lower(?)", values[0]), nil
+			})
+
+		b.ApplyFilter("name", "John")
+
+		sql, _, err := b.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "WHERE (lower(name) = lower($1))")
+
+		// другие билдеры используют встроенный оператор
+		other := NewSQLBuilder().
+			WithFrom("users").
+			WithFields("id").
+			WithFieldConfig("name", "name", ILIKE).
+			ApplyFilter("name", "John")
+
+		sql, _, err = other.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "name ILIKE $1")
+	})
+
+	t.Run("operator gets builder environment", func(t *testing.T) {
+		var dialect Dialect
+		b := NewSQLBuilder().
+			WithDialect(MySQL).
+			WithFrom("users").
+			WithFieldConfig("name", "name", "custom").
+			WithOpEnv("custom", func(env OpEnv, column string, values []string, cfg FieldConfig) (squirrel.Sqlizer, error) {
+				dialect = env.Dialect()
+				return nil, nil
+			})
+
+		b.ApplyFilter("name", "x")
+
+		assert.Equal(t, MySQL, dialect)
+		assert.Empty(t, b.whereConditions)
+	})
+
+	t.Run("override wraps built-in operator with another column", func(t *testing.T) {
+		gte, ok := NewSQLBuilder().lookupOp(GTE)
+		require.True(t, ok)
+		rng, ok := NewSQLBuilder().lookupOp(RANGE)
+		require.True(t, ok)
+
+		b := NewSQLBuilder().
+			WithFrom("orders").
+			WithFields("id").
+			WithFieldConfig("total", "total", GTE, FieldType(TypeInt)).
+			WithFieldConfig("period", "created_at", RANGE, FieldType(TypeInt)).
+			WithOpEnv(GTE, func(env OpEnv, column string, values []string, cfg FieldConfig) (squirrel.Sqlizer, error) {
+				return gte(env, "coalesce("+column+", 0)", values, cfg)
+			}).
+			WithOpEnv(RANGE, func(env OpEnv, column string, values []string, cfg FieldConfig) (squirrel.Sqlizer, error) {
+				return rng(env, "extract(year from "+column+")", values, cfg)
+			})
+
+		b.ApplyFilter("total", "10").ApplyFilter("period", "2020..2024")
+
+		sql, args, err := b.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "WHERE (coalesce(total, 0) >= $1 AND extract(year from created_at) >= $2 AND extract(year from created_at) < $3)")
+		assert.Equal(t, []any{int64(10), int64(2020), int64(2024)}, args)
+	})
+
+	t.Run("operator gets request context", func(t *testing.T) {
+		type key struct{}
+		var got any
+		b := NewSQLBuilderWithContext(context.WithValue(context.Background(), key{}, "tenant")).
+			WithFrom("users").
+			WithFieldConfig("name", "name", "custom").
+			WithOpEnv("custom", func(env OpEnv, column string, values []string, cfg FieldConfig) (squirrel.Sqlizer, error) {
+				got = env.Context().Value(key{})
+				return nil, nil
+			})
+
+		b.ApplyFilter("name", "x")
+
+		assert.Equal(t, "tenant", got)
+	})
+
+	t.Run("unknown operator", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithFrom("users").
+			WithFieldConfig("name", "name", "no_such_op")
+
+		b.ApplyFilter("name", "x")
+
+		_, _, err := b.BuildSelect()
+
+		assert.ErrorContains(t, err, "unknown operator")
+	})
+}
+
+func TestExprOperators(t *testing.T) {
+	tests := []struct {
+		name  string
+		op    Op
+		value string
+		where string
+		args  []any
+	}{
+		{"eq", EXPR_EQ, "111-111-111 11", "persons.snils2bcd64(snils) = persons.snils2bcd64($1)", []any{"111-111-111 11"}},
+		{"not eq", EXPR_NOT_EQ, "1", "persons.snils2bcd64(snils) <> persons.snils2bcd64($1)", []any{"1"}},
+		{"gte", EXPR_GTE, "1", "persons.snils2bcd64(snils) >= persons.snils2bcd64($1)", []any{"1"}},
+		{"like", EXPR_LIKE, "111", "persons.snils2bcd64(snils) LIKE persons.snils2bcd64($1)", []any{"111%"}},
+		{"in", EXPR_IN, "1,2", "persons.snils2bcd64(snils) IN (persons.snils2bcd64($1), persons.snils2bcd64($2))", []any{"1", "2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewSQLBuilder().
+				WithFrom("persons").
+				WithFields("id").
+				WithFieldConfig("snils", "persons.snils2bcd64(snils)", tt.op, ValueExpr("persons.snils2bcd64(?)"))
+
+			b.ApplyFilter("snils", tt.value)
+
+			sql, args, err := b.BuildSelect()
+
+			require.NoError(t, err)
+			assert.Contains(t, sql, tt.where)
+			assert.Equal(t, tt.args, args)
+		})
+	}
+
+	t.Run("left side args and typed value", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithFrom("goods").
+			WithFields("id").
+			WithFieldConfig("price", "coalesce(discount_price, ?)", EXPR_LT, ExprArgs(0), FieldType(TypeInt))
+
+		b.ApplyFilter("price", "100")
+
+		sql, args, err := b.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "coalesce(discount_price, $1) < $2")
+		assert.Equal(t, []any{0, int64(100)}, args)
+	})
+
+	t.Run("apply expr with call-site template", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithFrom("users").
+			WithFieldConfig("email", "lower(email)", EXPR_LIKE)
+
+		b.ApplyExpr("email", "lower(?)", "john%")
+
+		sql, args, err := b.whereConditions[0].ToSql()
+
+		require.NoError(t, err)
+		assert.Equal(t, "lower(email) LIKE lower(?)", sql)
+		assert.Equal(t, []any{"john%"}, args)
+	})
+
+	t.Run("apply expr with plain in", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithFrom("users").
+			WithFieldConfig("id", "users.id", IN)
+
+		b.ApplyExpr("id", "ignored", 1, 2)
+
+		sql, args, err := b.whereConditions[0].ToSql()
+
+		require.NoError(t, err)
+		assert.Equal(t, "users.id IN (?,?)", sql)
+		assert.Equal(t, []any{1, 2}, args)
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithFrom("users").
+			WithFieldConfig("name", "lower(name)", EXPR_EQ, ValueExpr("concat(?, ?)"))
+
+		b.ApplyFilter("name", "x")
+
+		_, _, err := b.BuildSelect()
+
+		assert.Error(t, err)
+	})
+}
+
+func TestFieldConfigRedefinition(t *testing.T) {
+	t.Run("strict mode", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithFrom("users").
+			WithFields("id").
+			WithFieldConfig("name", "users.name", ILIKE).
+			WithFieldConfig("name", "users.login", EQ)
+
+		assert.Equal(t, "users.name", b.fieldConfigs["name"].DBField)
+
+		_, _, err := b.BuildSelect()
+		assert.ErrorContains(t, err, `field "name" is already configured`)
+
+		// ошибка конфигурации переживает Reset
+		_, _, err = b.Reset().BuildSelect()
+		assert.Error(t, err)
+	})
+
+	t.Run("override", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithFrom("users").
+			WithFields("id").
+			WithFieldConfig("name", "users.name", ILIKE).
+			OverrideFieldConfig("name", "users.login", EQ)
+
+		b.ApplyFilter("name", "john")
+
+		sql, _, err := b.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "users.login = $1")
+		assert.NoError(t, b.Validate())
+	})
+
+	t.Run("multiple operators", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithFieldConfigMode(FieldConfigMulti).
+			WithFrom("goods g").
+			WithFields("g.id").
+			WithFieldConfig("price", "g.price", EQ, FieldType(TypeInt)).
+			WithFieldConfig("price", "g.price", GTE, FieldType(TypeInt)).
+			WithFieldConfig("price", "g.price", LTE, FieldType(TypeInt))
+
+		b.ApplyFilter("price[gte]", "10")
+		b.ApplyFilter("price[lte]", "100")
+		b.ApplyFilter("price", "50")
+
+		sql, args, err := b.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "WHERE (g.price >= $1 AND g.price <= $2 AND g.price = $3)")
+		assert.Equal(t, []any{int64(10), int64(100), int64(50)}, args)
+
+		b.ApplyFilter("price[like]", "1")
+		_, _, err = b.BuildSelect()
+		assert.ErrorContains(t, err, `field "price" has no operator "like"`)
+
+		// одинаковый оператор - все равно повтор
+		b.WithFieldConfig("price", "g.price", GTE)
+		assert.Error(t, b.Validate())
+	})
+}
+
+func TestValidate(t *testing.T) {
+	b := NewSQLBuilder().
+		WithFrom("public.users u").
+		WithFields("u.id").
+		WithLeftJoin("orders AS o", "o.user_id = u.id").
+		WithFieldConfig("name", "u.name", ILIKE).
+		WithFieldConfig("total", "o.total", GT).
+		WithFieldConfig("login", "public.users.login", EQ).
+		WithFieldConfig("snils", "persons.snils2bcd64(u.snils)", EXPR_EQ).
+		WithFieldConfig("plain", "status", EQ).
+		WithFieldConfig("corporate", "u.email LIKE '%@corp.com' AND u.note <> 'it''s x.y'", IS_NULL).
+		WithFieldConfig("orders_total", "(SELECT SUM(oo.total) FROM orders oo WHERE oo.user_id = u.id)", GTE).
+		WithFieldConfig("items", "(SELECT COUNT(*) FROM public.items AS i JOIN sales.products p ON p.id = i.product_id WHERE i.user_id = u.id)", GTE)
+
+	require.NoError(t, b.Validate())
+
+	b.WithFieldConfig("empty", "", EQ).
+		WithFieldConfig("unknown_op", "u.name", "no_such_op").
+		WithFieldConfig("unknown_source", "p.bio || ' ' || p.name", EQ).
+		WithFieldConfig("name", "u.login", EQ)
+
+	err := b.Validate()
+
+	require.Error(t, err)
+	assert.ErrorContains(t, err, `field "name" is configured more than once`)
+	assert.ErrorContains(t, err, `field "empty" has empty DBField`)
+	assert.ErrorContains(t, err, `field "unknown_op" has unknown operator "no_such_op"`)
+	assert.ErrorContains(t, err, `field "unknown_source" refers to unknown source "p"`)
+	assert.Equal(t, 1, strings.Count(err.Error(), `unknown source "p"`))
+}
+
+func TestListDefinition(t *testing.T) {
+	newDefinition := func(t *testing.T) *ListDefinition {
+		def, err := NewListDefinition(NewSQLBuilder().
+			WithFrom("users u").
+			WithFields("u.id", "u.name").
+			WithFieldConfig("name", "u.name", ILIKE).
+			WithFieldConfig("age", "u.age", GTE, FieldType(TypeInt)).
+			WithMaxLimit(100).
+			Limit(20))
+		require.NoError(t, err)
+		return def
+	}
+
+	t.Run("request keeps configuration", func(t *testing.T) {
+		b := newDefinition(t).NewRequest()
+
+		b.ApplyFilter("name", "john").Sort("name", "ASC")
+
+		sql, args, err := b.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT u.id, u.name FROM users u WHERE (u.name ILIKE $1) ORDER BY u.name ASC LIMIT 20", sql)
+		assert.Equal(t, []any{"%john%"}, args)
+	})
+
+	t.Run("max limit", func(t *testing.T) {
+		b := newDefinition(t).NewRequest().Limit(1000)
+		assert.Equal(t, uint64(100), b.limit)
+
+		b.Page(2, 500)
+		assert.Equal(t, uint64(100), b.limit)
+		assert.Equal(t, uint64(100), b.offset)
+	})
+
+	t.Run("requests are isolated", func(t *testing.T) {
+		def := newDefinition(t)
+
+		first := def.NewRequest().
+			OverrideFieldConfig("name", "u.login", EQ).
+			WithFields("u.email").
+			ApplyFilter("name", "john")
+		first.Reset()
+
+		second := def.NewRequest().ApplyFilter("name", "john")
+
+		sql, _, err := second.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "SELECT u.id, u.name FROM users u WHERE (u.name ILIKE $1)")
+	})
+
+	t.Run("invalid definition", func(t *testing.T) {
+		_, err := NewListDefinition(NewSQLBuilder().
+			WithFrom("users").
+			WithFieldConfig("name", "", EQ))
+
+		assert.Error(t, err)
+	})
+
+	t.Run("concurrent requests", func(t *testing.T) {
+		def := newDefinition(t)
+
+		var wg sync.WaitGroup
+		for i := range 64 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				b := def.NewRequest().
+					ApplyFilter("name", "john").
+					ApplyFilter("age", strconv.Itoa(i)).
+					WithFieldConfig("extra", "u.extra", EQ).
+					Sort("age", "DESC")
+
+				sql, args, err := b.BuildSelect()
+				assert.NoError(t, err)
+				assert.Contains(t, sql, "WHERE (u.name ILIKE $1 AND u.age >= $2)")
+				assert.Equal(t, []any{"%john%", int64(i)}, args)
+
+				b.Reset()
+			}()
+		}
+		wg.Wait()
+	})
+}
+
+func TestSparseFieldsets(t *testing.T) {
+	b := NewSQLBuilder().
+		WithFrom("users u").
+		WithSelectField("id", "u.id", AlwaysSelected()).
+		WithSelectField("name", "u.name").
+		WithSelectField("email", "u.email").
+		WithSelectField("orders", "(SELECT count(*) FROM orders o WHERE o.user_id = u.id)")
+
+	t.Run("all fields by default", func(t *testing.T) {
+		sql, _, err := b.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "SELECT u.id AS id, u.name AS name, u.email AS email, "+
+			"(SELECT count(*) FROM orders o WHERE o.user_id = u.id) AS orders FROM users u")
+		assert.Equal(t, []string{"id", "name", "email", "orders"}, b.SelectedFields())
+	})
+
+	t.Run("requested fields", func(t *testing.T) {
+		b.Reset().ApplyFields([]string{"email,name"})
+
+		sql, _, err := b.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "SELECT u.id AS id, u.name AS name, u.email AS email FROM users u")
+		assert.Equal(t, []string{"id", "name", "email"}, b.SelectedFields())
+	})
+
+	t.Run("missing fields parameter", func(t *testing.T) {
+		for _, fields := range [][]string{nil, {}, {""}} {
+			b.Reset().ApplyFields(fields)
+
+			require.NoError(t, b.Err())
+			assert.Equal(t, []string{"id", "name", "email", "orders"}, b.SelectedFields())
+		}
+	})
+
+	t.Run("unknown field", func(t *testing.T) {
+		b.Reset().ApplyFields([]string{"name", "password"})
+
+		_, _, err := b.BuildSelect()
+
+		assert.ErrorContains(t, err, `unknown field "password"`)
+	})
+
+	t.Run("scan destination", func(t *testing.T) {
+		var user struct {
+			ID     int64 `db:"id"`
+			Name   string
+			Email  string `db:"email"`
+			Orders int
+		}
+
+		b.Reset().ApplyFields([]string{"email"})
+		dest, err := b.ScanDest(&user)
+
+		require.NoError(t, err)
+		assert.Equal(t, []any{&user.ID, &user.Email}, dest)
+
+		_, err = b.ScanDest(user)
+		assert.Error(t, err)
+
+		_, err = b.Clone().WithFields("u.created_at AS created").ScanDest(&user)
+		assert.ErrorContains(t, err, `no field for column "created"`)
+	})
+
+	t.Run("scan destination ignores case", func(t *testing.T) {
+		var row struct {
+			ID        int64 `db:"ID"`
+			CreatedAt time.Time
+		}
+
+		dest, err := NewSQLBuilder().
+			WithFrom("users u").
+			WithFields("u.id", "u.created_at AS createdAt").
+			ScanDest(&row)
+
+		require.NoError(t, err)
+		assert.Equal(t, []any{&row.ID, &row.CreatedAt}, dest)
+	})
+}
+
+func TestLazyJoins(t *testing.T) {
+	b := NewSQLBuilder().
+		WithFrom("users u").
+		WithFields("u.id").
+		WithInnerJoin("accounts a", "a.id = u.account_id").
+		WithLazyLeftJoin("city", "cities c", "c.id = ad.city_id", "address").
+		WithLazyLeftJoin("address", "addresses ad", "ad.user_id = u.id").
+		WithLazyLeftJoin("profile", "profiles p", "p.user_id = u.id").
+		WithFieldConfig("city", "c.name", EQ, Joins("city")).
+		WithFieldConfig("bio", "p.bio", ILIKE, Joins("profile")).
+		WithSelectField("login", "u.login").
+		WithSelectField("avatar", "p.avatar", Joins("profile"))
+
+	t.Run("no active joins", func(t *testing.T) {
+		b.Reset().ApplyFields([]string{"login"})
+
+		sql, _, err := b.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT u.id, u.login AS login FROM users u JOIN accounts a ON a.id = u.account_id", sql)
+	})
+
+	t.Run("filter join with dependency", func(t *testing.T) {
+		b.Reset().ApplyFields([]string{"login"}).ApplyFilter("city", "Moscow")
+
+		sql, _, err := b.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT u.id, u.login AS login FROM users u JOIN accounts a ON a.id = u.account_id "+
+			"LEFT JOIN addresses ad ON ad.user_id = u.id LEFT JOIN cities c ON c.id = ad.city_id "+
+			"WHERE (c.name = $1)", sql)
+	})
+
+	t.Run("sort and projection joins are not counted", func(t *testing.T) {
+		b.Reset().Sort("bio", "ASC")
+
+		sql, _, err := b.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "LEFT JOIN profiles p ON p.user_id = u.id")
+		assert.Contains(t, sql, "p.avatar AS avatar")
+
+		sql, _, err = b.BuildCount()
+
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT COUNT(*) FROM (SELECT 1 FROM users u JOIN accounts a ON a.id = u.account_id) AS subquery", sql)
+	})
+
+	t.Run("inner join is always counted", func(t *testing.T) {
+		withCompany := b.Clone().
+			WithLazyInnerJoin("company", "companies co", "co.id = u.company_id").
+			WithSelectField("company", "co.name", Joins("company"))
+
+		const join = "JOIN accounts a ON a.id = u.account_id JOIN companies co ON co.id = u.company_id"
+
+		sql, _, err := withCompany.BuildSelect()
+		require.NoError(t, err)
+		assert.Contains(t, sql, "co.name AS company FROM users u ")
+		assert.Contains(t, sql, " JOIN companies co ON co.id = u.company_id")
+
+		sql, _, err = withCompany.BuildCount()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT COUNT(*) FROM (SELECT 1 FROM users u "+join+") AS subquery", sql)
+
+		sql, _, err = withCompany.ApplyFields([]string{"login"}).BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT u.id, u.login AS login FROM users u "+join, sql)
+	})
+
+	t.Run("direct condition by alias", func(t *testing.T) {
+		b.Reset().ILike("bio", "go")
+
+		sql, _, err := b.BuildCount()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "LEFT JOIN profiles p ON p.user_id = u.id WHERE (p.bio ILIKE $1)")
+	})
+
+	t.Run("reset drops joins", func(t *testing.T) {
+		b.Reset().ApplyFilter("city", "Moscow").Reset()
+
+		sql, _, err := b.BuildCount()
+
+		require.NoError(t, err)
+		assert.NotContains(t, sql, "cities")
+	})
+
+	t.Run("validate", func(t *testing.T) {
+		require.NoError(t, b.Validate())
+
+		invalid := b.Clone().
+			WithLazyLeftJoin("orders", "orders o", "o.user_id = u.id", "payments").
+			WithFieldConfig("total", "o.total", GT, Joins("order"))
+
+		err := invalid.Validate()
+
+		assert.ErrorContains(t, err, `join "orders" depends on unknown join "payments"`)
+		assert.ErrorContains(t, err, `field "total" requires unknown join "order"`)
+
+		invalid.ApplyFilter("total", "1")
+		_, _, err = invalid.BuildSelect()
+		assert.ErrorContains(t, err, `unknown join "order"`)
+	})
+}
+
+func TestRelationFilters(t *testing.T) {
+	b := NewSQLBuilder().
+		WithFrom("users u").
+		WithFields("u.id").
+		WithRelation("orders", "orders o", "o.user_id = u.id").
+		WithFieldConfig("orders.status", "o.status", EQ, Relation("orders")).
+		WithFieldConfig("orders.total", "o.total", GT, Relation("orders"), FieldType(TypeInt)).
+		WithFieldConfig("name", "u.name", ILIKE)
+
+	t.Run("exists", func(t *testing.T) {
+		b.Reset().
+			ApplyFilter("name", "john").
+			ApplyFilter("orders.status", "paid").
+			ApplyFilter("orders.total", "100")
+
+		sql, args, err := b.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT u.id FROM users u WHERE (u.name ILIKE $1 AND "+
+			"EXISTS (SELECT 1 FROM orders o WHERE o.user_id = u.id AND o.status = $2 AND o.total > $3))", sql)
+		assert.Equal(t, []any{"%john%", "paid", int64(100)}, args)
+
+		sql, _, err = b.BuildCount()
+
+		require.NoError(t, err)
+		assert.NotContains(t, sql, "JOIN")
+		assert.Contains(t, sql, "EXISTS (SELECT 1 FROM orders o")
+	})
+
+	t.Run("not exists", func(t *testing.T) {
+		b.Reset().
+			ApplyFilter("orders.status[not]", "cancelled").
+			ApplyFilter("orders.status", "paid")
+
+		sql, args, err := b.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "WHERE (NOT EXISTS (SELECT 1 FROM orders o WHERE o.user_id = u.id AND o.status = $1) AND "+
+			"EXISTS (SELECT 1 FROM orders o WHERE o.user_id = u.id AND o.status = $2))")
+		assert.Equal(t, []any{"cancelled", "paid"}, args)
+	})
+
+	t.Run("has relation", func(t *testing.T) {
+		b.Reset().ApplyFilter("orders", "false")
+
+		sql, _, err := b.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "WHERE (NOT EXISTS (SELECT 1 FROM orders o WHERE o.user_id = u.id))")
+	})
+
+	t.Run("count threshold", func(t *testing.T) {
+		b.Reset().
+			ApplyFilter("orders.count[gte]", "3").
+			ApplyFilter("orders.status", "paid").
+			ApplyFilter("name", "john")
+
+		sql, args, err := b.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "WHERE ((SELECT COUNT(*) FROM orders o WHERE o.user_id = u.id AND o.status = $1) >= $2 AND u.name ILIKE $3)")
+		assert.Equal(t, []any{"paid", int64(3), "%john%"}, args)
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		for key, value := range map[string]string{"orders.count[gte]": "many", "orders": "maybe", "orders.count[like]": "1"} {
+			b.Reset().ApplyFilter(key, value)
+
+			_, _, err := b.BuildSelect()
+			assert.Error(t, err, key)
+		}
+	})
+
+	t.Run("validate", func(t *testing.T) {
+		require.NoError(t, b.Validate())
+
+		invalid := b.Clone().WithFieldConfig("payments.sum", "p.sum", GT, Relation("payments"))
+
+		assert.ErrorContains(t, invalid.Validate(), `field "payments.sum" refers to unknown relation "payments"`)
+	})
+}
+
+func TestPresets(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	b := NewSQLBuilder().
+		WithFrom("tasks").
+		WithFields("id").
+		WithClock(func() time.Time { return now }).
+		WithFieldConfig("assignee", "assignee_id", EQ).
+		WithPreset("overdue", func(b *SQLBuilder) squirrel.Sqlizer {
+			return squirrel.And{squirrel.NotEq{"status": "done"}, squirrel.Lt{"due_at": b.Now()}}
+		}).
+		WithPreset("urgent", func(b *SQLBuilder) squirrel.Sqlizer {
+			return squirrel.Eq{"priority": "critical"}
+		}).
+		WithDefaultPreset("not_deleted", func(b *SQLBuilder) squirrel.Sqlizer {
+			return squirrel.Eq{"deleted_at": nil}
+		})
+
+	t.Run("default preset", func(t *testing.T) {
+		sql, _, err := b.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "WHERE (deleted_at IS NULL)")
+	})
+
+	t.Run("preset from filter with explicit filters", func(t *testing.T) {
+		b.Reset().
+			ApplyFilter("assignee", "7").
+			ApplyFilter("preset", "overdue,urgent")
+
+		sql, args, err := b.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "WHERE (assignee_id = $1 AND (status <> $2 AND due_at < $3) AND priority = $4 AND deleted_at IS NULL)")
+		assert.Equal(t, []any{"7", "done", now, "critical"}, args)
+
+		sql, _, err = b.BuildCount()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "deleted_at IS NULL")
+	})
+
+	t.Run("opt out of default presets", func(t *testing.T) {
+		b.Reset().WithoutDefaultPresets()
+
+		sql, _, err := b.BuildSelect()
+
+		require.NoError(t, err)
+		assert.NotContains(t, sql, "WHERE")
+
+		// Reset возвращает пресеты по умолчанию
+		sql, _, err = b.Reset().BuildSelect()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "deleted_at IS NULL")
+	})
+
+	t.Run("custom param", func(t *testing.T) {
+		custom := b.Clone().WithPresetParam("scope").ApplyFilter("scope", "urgent")
+
+		sql, _, err := custom.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "priority = $1")
+	})
+
+	t.Run("unknown preset", func(t *testing.T) {
+		_, _, err := b.Reset().ApplyPreset("nope").BuildSelect()
+
+		assert.ErrorContains(t, err, `unknown preset "nope"`)
+	})
+}
+
+func TestRequiredScopes(t *testing.T) {
+	type tenantKey struct{}
+
+	def, err := NewListDefinition(NewSQLBuilder().
+		WithFrom("documents").
+		WithFields("id").
+		WithEstimate("documents").
+		WithFieldConfig("title", "title", ILIKE).
+		WithRequiredScope("tenant", ContextScope("tenant_id", tenantKey{})))
+	require.NoError(t, err)
+
+	t.Run("scope from context", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), tenantKey{}, 42)
+		b := def.NewRequestWithContext(ctx).ApplyFilter("title", "report")
+
+		sql, args, err := b.BuildSelect()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "WHERE (tenant_id = $1 AND title ILIKE $2)")
+		assert.Equal(t, []any{42, "%report%"}, args)
+
+		// ни Reset, ни приблизительный подсчет не снимают ограничение
+		sql, args, err = b.Reset().BuildCount()
+
+		require.NoError(t, err)
+		assert.Contains(t, sql, "WHERE (tenant_id = $1)")
+		assert.Equal(t, []any{42}, args)
+	})
+
+	t.Run("missing scope", func(t *testing.T) {
+		b := def.NewRequest().ApplyFilter("title", "report")
+
+		_, _, err := b.BuildSelect()
+		assert.ErrorIs(t, err, ErrScopeNotSatisfied)
+
+		_, _, err = b.BuildCount()
+		assert.ErrorIs(t, err, ErrScopeNotSatisfied)
+	})
+
+	t.Run("definition drops builder context", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), tenantKey{}, 42)
+		def, err := NewListDefinition(NewSQLBuilderWithContext(ctx).
+			WithFrom("documents").
+			WithFields("id").
+			WithRequiredScope("tenant", ContextScope("tenant_id", tenantKey{})))
+		require.NoError(t, err)
+
+		_, _, err = def.NewRequest().BuildSelect()
+		assert.ErrorIs(t, err, ErrScopeNotSatisfied)
+
+		other := context.WithValue(context.Background(), tenantKey{}, 7)
+		_, args, err := def.NewRequestWithContext(other).BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, []any{7}, args)
+	})
+
+	t.Run("scope returns nil", func(t *testing.T) {
+		b := NewSQLBuilderWithContext(context.Background()).
+			WithFrom("documents").
+			WithFields("id").
+			WithRequiredScope("owner", func(ctx context.Context) (squirrel.Sqlizer, error) {
+				return nil, nil
+			})
+
+		_, _, err := b.BuildSelect()
+		assert.ErrorIs(t, err, ErrScopeNotSatisfied)
+	})
+}
+
+func TestFieldPermissions(t *testing.T) {
+	b := NewSQLBuilder().
+		WithFrom("employees").
+		WithFields("id").
+		WithFieldConfig("name", "name", EQ).
+		WithFieldConfig("salary", "salary", GTE, FieldType(TypeInt), Permissions("hr")).
+		WithSelectField("salary", "salary", Masked()).
+		WithSelectField("email", "email", Permissions("contacts"))
+
+	t.Run("permitted", func(t *testing.T) {
+		sql, args, err := b.Clone().
+			WithPermissions("hr", "contacts").
+			ApplyFilter("salary", "1000").
+			Sort("salary", "DESC").
+			BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT id, salary, email FROM employees WHERE (salary >= $1) ORDER BY salary DESC", sql)
+		assert.Equal(t, []interface{}{int64(1000)}, args)
+	})
+
+	t.Run("masked and dropped columns", func(t *testing.T) {
+		sql, _, err := b.BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT id, NULL AS salary FROM employees LIMIT 7", sql)
+		assert.Equal(t, []string{"id", "salary"}, b.SelectedFields())
+	})
+
+	t.Run("fixed columns", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithFrom("employees e").
+			WithFields("e.id", "e.salary", "e.phone AS phone", "e.bonus AS premium").
+			WithFieldConfig("salary", "e.salary", GTE, Permissions("hr")).
+			WithFieldConfig("premium", "e.bonus", GTE, Permissions("hr")).
+			WithSelectField("contact", "e.phone", Permissions("contacts"), Masked())
+
+		sql, _, err := b.BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT e.id, NULL AS phone, NULL AS contact FROM employees e LIMIT 7", sql)
+		assert.Equal(t, []string{"id", "phone", "contact"}, b.SelectedFields())
+
+		sql, _, err = b.WithPermissions("hr", "contacts").BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT e.id, e.salary, e.phone AS phone, e.bonus AS premium, e.phone AS contact FROM employees e LIMIT 7", sql)
+	})
+
+	t.Run("filter without permission", func(t *testing.T) {
+		_, _, err := b.Reset().ApplyFilter("name", "Bob").ApplyFilter("salary", "1000").BuildSelect()
+		var permErr *PermissionError
+		require.ErrorAs(t, err, &permErr)
+		assert.Equal(t, "salary", permErr.Field)
+		assert.Equal(t, "hr", permErr.Permission)
+	})
+
+	t.Run("sort without permission", func(t *testing.T) {
+		_, _, err := b.Clone().WithPermissions("contacts").Sort("salary", "ASC").BuildSelect()
+		var permErr *PermissionError
+		require.ErrorAs(t, err, &permErr)
+	})
+
+	t.Run("condition without permission", func(t *testing.T) {
+		_, _, err := b.Reset().Gt("salary", 10).BuildSelect()
+		var permErr *PermissionError
+		require.ErrorAs(t, err, &permErr)
+	})
+
+	t.Run("operator variant keeps field permissions", func(t *testing.T) {
+		multi := NewSQLBuilder().
+			WithFrom("employees").
+			WithFields("id").
+			WithFieldConfigMode(FieldConfigMulti).
+			WithFieldConfig("salary", "salary", EQ, Permissions("hr")).
+			WithFieldConfig("salary", "salary", GTE)
+
+		_, _, err := multi.ApplyFilter("salary[gte]", "100").BuildSelect()
+		var permErr *PermissionError
+		require.ErrorAs(t, err, &permErr)
+		assert.Equal(t, "hr", permErr.Permission)
+
+		sql, _, err := multi.Reset().WithPermissions("hr").ApplyFilter("salary[gte]", "100").BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT id FROM employees WHERE (salary >= $1)", sql)
+	})
+}
+
+func TestFacets(t *testing.T) {
+	b := NewSQLBuilder().
+		WithFrom("orders o").
+		WithFields("o.id").
+		WithLazyLeftJoin("city", "cities c", "c.id = o.city_id").
+		WithFieldConfig("status", "o.status", IN).
+		WithFieldConfig("city", "c.name", EQ, Joins("city")).
+		WithFieldConfig("type", "o.type", EQ)
+
+	t.Run("own filter excluded", func(t *testing.T) {
+		queries, err := b.Clone().
+			WithDialect(MySQL).
+			ApplyFilter("status", "new,done").
+			ApplyFilter("type", "retail").
+			BuildFacets("status", "type")
+		require.NoError(t, err)
+		require.Len(t, queries, 2)
+
+		assert.Equal(t, []string{"status"}, queries[0].Fields)
+		assert.Equal(t, "SELECT o.status AS status, COUNT(*) AS count FROM orders o WHERE (o.type = ?) GROUP BY o.status ORDER BY count DESC, status", queries[0].SQL)
+		assert.Equal(t, []any{"retail"}, queries[0].Args)
+
+		assert.Equal(t, "SELECT o.type AS type, COUNT(*) AS count FROM orders o WHERE (o.status IN (?,?)) GROUP BY o.type ORDER BY count DESC, type", queries[1].SQL)
+		assert.Equal(t, []any{"new", "done"}, queries[1].Args)
+	})
+
+	t.Run("grouping sets", func(t *testing.T) {
+		queries, err := b.Reset().
+			ApplyFilter("status", "new").
+			BuildFacets("status", "city", "type")
+		require.NoError(t, err)
+		require.Len(t, queries, 2)
+
+		assert.Equal(t, []string{"city", "type"}, queries[0].Fields)
+		assert.Equal(t, "SELECT c.name AS city, o.type AS type, GROUPING(c.name, o.type) AS facet_grouping, COUNT(*) AS count "+
+			"FROM orders o LEFT JOIN cities c ON c.id = o.city_id WHERE (o.status IN ($1)) "+
+			"GROUP BY GROUPING SETS ((c.name), (o.type)) ORDER BY count DESC", queries[0].SQL)
+		assert.Equal(t, "SELECT o.status AS status, COUNT(*) AS count FROM orders o GROUP BY o.status ORDER BY count DESC, status", queries[1].SQL)
+		assert.Empty(t, queries[1].Args)
+	})
+
+	t.Run("collect", func(t *testing.T) {
+		query := &FacetQuery{Fields: []string{"city", "type"}}
+		facets := Facets{}
+
+		rows := []struct {
+			city, kind any
+			grouping   int64
+			count      int64
+		}{
+			{[]byte("Moscow"), nil, 1, 12},
+			{nil, "retail", 2, 40},
+		}
+		for _, row := range rows {
+			dest := query.Dest()
+			*dest[0].(*any), *dest[1].(*any) = row.city, row.kind
+			*dest[2].(*int64), *dest[3].(*int64) = row.grouping, row.count
+			query.Collect(facets)
+		}
+
+		assert.Equal(t, Facets{
+			"city": {{Value: "Moscow", Count: 12}},
+			"type": {{Value: "retail", Count: 40}},
+		}, facets)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := b.Reset().BuildFacets("unknown")
+		assert.Error(t, err)
+
+		restricted := b.Clone().OverrideFieldConfig("type", "o.type", EQ, Permissions("admin"))
+		_, err = restricted.BuildFacets("type")
+		var permErr *PermissionError
+		assert.ErrorAs(t, err, &permErr)
+	})
+}
+
+func TestDistinct(t *testing.T) {
+	type tenantKey struct{}
+
+	ctx := context.WithValue(context.Background(), tenantKey{}, 7)
+	b := NewSQLBuilderWithContext(ctx).
+		WithFrom("users").
+		WithFields("id").
+		WithFieldConfig("city", "city", IN).
+		WithFieldConfig("age", "age", GTE, FieldType(TypeInt)).
+		WithRequiredScope("tenant", ContextScope("tenant_id", tenantKey{}))
+
+	t.Run("by frequency", func(t *testing.T) {
+		sql, args, err := b.
+			ApplyFilter("city", "Berlin").
+			ApplyFilter("age", "18").
+			BuildDistinct("city", "Mos", 20)
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT city AS value, COUNT(*) AS count FROM users "+
+			"WHERE (tenant_id = $1 AND age >= $2) AND city IS NOT NULL AND city ILIKE $3 "+
+			"GROUP BY city ORDER BY count DESC, value LIMIT 20", sql)
+		assert.Equal(t, []any{7, int64(18), "Mos%"}, args)
+	})
+
+	t.Run("alphabetical", func(t *testing.T) {
+		sql, args, err := b.Clone().
+			WithDialect(SQLite).
+			WithMaxLimit(10).
+			BuildDistinct("city", "50%_", 20, DistinctAlphabetical)
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT city AS value, COUNT(*) AS count FROM users "+
+			`WHERE (tenant_id = ?) AND city IS NOT NULL AND city LIKE ? ESCAPE '\' `+
+			"GROUP BY city ORDER BY value LIMIT 10", sql)
+		assert.Equal(t, []any{7, `50\%\_%`}, args)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, _, err := b.Reset().BuildDistinct("unknown", "", 10)
+		assert.Error(t, err)
+
+		_, _, err = NewSQLBuilder().
+			WithFrom("users").
+			WithRequiredScope("tenant", ContextScope("tenant_id", tenantKey{})).
+			WithFieldConfig("city", "city", IN).
+			BuildDistinct("city", "", 10)
+		assert.ErrorIs(t, err, ErrScopeNotSatisfied)
+	})
+}
+
+func TestAggregates(t *testing.T) {
+	b := NewSQLBuilder().
+		WithFrom("orders o").
+		WithFields("o.id").
+		WithLazyLeftJoin("customer", "customers c", "c.id = o.customer_id").
+		WithFieldConfig("price", "o.price", GTE, FieldType(TypeFloat)).
+		WithFieldConfig("discount", "c.discount", EQ, Joins("customer")).
+		ApplyFilter("price", "10")
+
+	query, err := b.BuildAggregates(map[string]AggFunc{
+		"total":     Count(),
+		"min_price": Min("price"),
+		"max_price": Max("price"),
+		"avg_disc":  Avg("discount"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"avg_disc", "max_price", "min_price", "total"}, query.Aliases)
+	assert.Equal(t, "SELECT AVG(c.discount) AS avg_disc, MAX(o.price) AS max_price, MIN(o.price) AS min_price, COUNT(*) AS total "+
+		"FROM orders o LEFT JOIN customers c ON c.id = o.customer_id WHERE (o.price >= $1)", query.SQL)
+	assert.Equal(t, []any{10.0}, query.Args)
+
+	dest := query.Dest()
+	require.Len(t, dest, 4)
+	*dest[0].(*sql.NullFloat64) = sql.NullFloat64{}
+	*dest[1].(*any) = []byte("99.5")
+	*dest[2].(*any) = 10.0
+	*dest[3].(*int64) = 3
+	assert.Equal(t, Aggregates{"avg_disc": nil, "max_price": "99.5", "min_price": 10.0, "total": int64(3)}, query.Result())
+
+	_, err = b.BuildAggregates(map[string]AggFunc{"x": {Func: "MEDIAN", Field: "price"}})
+	assert.Error(t, err)
+	_, err = b.BuildAggregates(map[string]AggFunc{"x": Sum("")})
+	assert.Error(t, err)
+}
+
+func TestGroupedList(t *testing.T) {
+	b := NewSQLBuilder().
+		WithFrom("orders o").
+		WithEstimate("orders").
+		WithFields("o.customer_id").
+		WithSelectField("revenue", "SUM(o.total)").
+		WithGroupBy("o.customer_id").
+		WithFieldConfig("status", "o.status", EQ).
+		WithFieldConfig("revenue", "SUM(o.total)", GTE, FieldType(TypeFloat), Aggregate())
+
+	t.Run("select", func(t *testing.T) {
+		sql, args, err := b.
+			ApplyFilter("status", "paid").
+			ApplyFilter("revenue", "1000").
+			Sort("revenue", "DESC").
+			BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT o.customer_id, SUM(o.total) AS revenue FROM orders o WHERE (o.status = $1) "+
+			"GROUP BY o.customer_id HAVING (SUM(o.total) >= $2) ORDER BY SUM(o.total) DESC LIMIT 7", sql)
+		assert.Equal(t, []any{"paid", 1000.0}, args)
+	})
+
+	t.Run("count groups", func(t *testing.T) {
+		sql, args, err := b.Reset().ApplyFilter("revenue", "1000").BuildCount()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT COUNT(*) FROM (SELECT 1 FROM orders o GROUP BY o.customer_id HAVING (SUM(o.total) >= $1)) AS subquery", sql)
+		assert.Equal(t, []any{1000.0}, args)
+
+		// без фильтров приблизительный подсчет строк таблицы не подходит
+		sql, _, err = b.Reset().BuildCount()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT COUNT(*) FROM (SELECT 1 FROM orders o GROUP BY o.customer_id) AS subquery", sql)
+	})
+
+	t.Run("keyset on aggregate", func(t *testing.T) {
+		sql, args, err := b.Clone().
+			WithTieBreaker("o.customer_id").
+			ApplyFilter("status", "paid").
+			ApplyFilter("revenue", "1000").
+			Sort("revenue", "DESC").
+			After(map[string]any{"revenue": 1500.0, "o.customer_id": 42}).
+			BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT o.customer_id, SUM(o.total) AS revenue FROM orders o WHERE (o.status = $1) "+
+			"GROUP BY o.customer_id HAVING (SUM(o.total) >= $2) AND ((SUM(o.total) < $3) OR (SUM(o.total) = $4 AND o.customer_id > $5)) "+
+			"ORDER BY SUM(o.total) DESC, o.customer_id ASC", sql)
+		assert.Equal(t, []any{"paid", 1000.0, 1500.0, 1500.0, 42}, args)
+	})
+
+	t.Run("group by joined column", func(t *testing.T) {
+		joined := NewSQLBuilder().
+			WithFrom("orders o").
+			WithLazyLeftJoin("customer", "customers c", "c.id = o.customer_id").
+			WithSelectField("customer", "c.name", Joins("customer")).
+			WithSelectField("revenue", "SUM(o.total)").
+			WithGroupBy("c.name")
+		require.NoError(t, joined.Validate())
+
+		sql, _, err := joined.BuildCount()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT COUNT(*) FROM (SELECT 1 FROM orders o LEFT JOIN customers c ON c.id = o.customer_id GROUP BY c.name) AS subquery", sql)
+
+		// поле с JOIN не запрошено, но группировка на него ссылается
+		sql, _, err = joined.WithGroupByJoins("customer").ApplyFields([]string{"revenue"}).BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT SUM(o.total) AS revenue FROM orders o LEFT JOIN customers c ON c.id = o.customer_id GROUP BY c.name LIMIT 7", sql)
+
+		assert.ErrorContains(t, joined.WithGroupByJoins("region").Validate(), `group by requires unknown join "region"`)
+	})
+
+	t.Run("sort by select alias", func(t *testing.T) {
+		sql, _, err := NewSQLBuilder().
+			WithFrom("orders").
+			WithFields("customer_id").
+			WithSelectField("orders_count", "COUNT(*)").
+			WithGroupBy("customer_id").
+			Sort("orders_count", "DESC").
+			BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT customer_id, COUNT(*) AS orders_count FROM orders GROUP BY customer_id ORDER BY orders_count DESC LIMIT 7", sql)
+	})
+
+	t.Run("row queries are not supported", func(t *testing.T) {
+		// группировка без фильтров и фильтр по агрегату без WithGroupBy
+		having := NewSQLBuilder().
+			WithFrom("orders o").
+			WithFieldConfig("status", "o.status", EQ).
+			WithFieldConfig("revenue", "SUM(o.total)", GTE, FieldType(TypeFloat), Aggregate()).
+			ApplyFilter("revenue", "1000")
+
+		for _, grouped := range []*SQLBuilder{b.Reset(), having} {
+			_, err := grouped.BuildFacets("status")
+			assert.ErrorContains(t, err, "BuildFacets is not supported for grouped lists")
+
+			_, _, err = grouped.BuildDistinct("status", "", 10)
+			assert.ErrorContains(t, err, "BuildDistinct is not supported for grouped lists")
+
+			_, err = grouped.BuildAggregates(map[string]AggFunc{"orders": Count()})
+			assert.ErrorContains(t, err, "BuildAggregates is not supported for grouped lists")
+
+			_, err = grouped.BuildTimeSeries("o.created_at", BucketDay, map[string]AggFunc{"orders": Count()}, nil)
+			assert.ErrorContains(t, err, "BuildTimeSeries is not supported for grouped lists")
+		}
+
+		_, err := having.Reset().BuildFacets("status")
+		assert.NoError(t, err)
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		sql, _, err := b.ApplyFilter("revenue", "1000").Reset().BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT o.customer_id, SUM(o.total) AS revenue FROM orders o GROUP BY o.customer_id", sql)
+	})
+}
+
+func TestTimeSeries(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	require.NoError(t, err)
+
+	b := NewSQLBuilder().
+		WithFrom("orders").
+		WithFields("id").
+		WithFieldConfig("created", "created_at", GTE, FieldType(TypeTime)).
+		WithFieldConfig("status", "status", EQ).
+		WithClock(func() time.Time { return time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC) }).
+		ApplyFilter("status", "paid")
+	aggregates := map[string]AggFunc{"orders": Count(), "revenue": Sum("total")}
+
+	t.Run("postgres", func(t *testing.T) {
+		query, err := b.WithDialect(PostgreSQL).BuildTimeSeries("created", BucketDay, aggregates, moscow)
+		require.NoError(t, err)
+		assert.Equal(t, "WITH series AS ("+
+			"SELECT date_trunc('day', created_at AT TIME ZONE $1) AS bucket, COUNT(*) AS orders, SUM(total) AS revenue "+
+			"FROM orders WHERE (status = $2) GROUP BY 1) "+
+			"SELECT g.bucket AS bucket, COALESCE(series.orders, 0) AS orders, series.revenue "+
+			"FROM generate_series((SELECT MIN(bucket) FROM series), (SELECT MAX(bucket) FROM series), '1 day'::interval) AS g(bucket) "+
+			"LEFT JOIN series ON series.bucket = g.bucket ORDER BY g.bucket", query.SQL)
+		assert.Equal(t, []any{"Europe/Moscow", "paid"}, query.Args)
+	})
+
+	t.Run("mysql", func(t *testing.T) {
+		query, err := b.WithDialect(MySQL).BuildTimeSeries("created", BucketWeek, aggregates, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT DATE(CONVERT_TZ(created_at, '+00:00', ?)) - INTERVAL WEEKDAY(CONVERT_TZ(created_at, '+00:00', ?)) DAY AS bucket, "+
+			"COUNT(*) AS orders, SUM(total) AS revenue FROM orders WHERE (status = ?) GROUP BY 1 ORDER BY bucket", query.SQL)
+		assert.Equal(t, []any{"UTC", "UTC", "paid"}, query.Args)
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		query, err := b.WithDialect(SQLite).BuildTimeSeries("created", BucketMonth, map[string]AggFunc{"orders": Count()}, moscow)
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT strftime('%Y-%m-01', created_at, ?) AS bucket, COUNT(*) AS orders FROM orders WHERE (status = ?) GROUP BY 1 ORDER BY bucket", query.SQL)
+		assert.Equal(t, []any{"+180 minutes", "paid"}, query.Args)
+	})
+
+	t.Run("gap filling", func(t *testing.T) {
+		query, err := b.WithDialect(SQLite).BuildTimeSeries("created", BucketDay, aggregates, moscow)
+		require.NoError(t, err)
+
+		rows := []struct {
+			bucket  string
+			orders  int64
+			revenue float64
+		}{
+			{"2024-03-01", 2, 100},
+			{"2024-03-04", 1, 50},
+		}
+		for _, row := range rows {
+			dest := query.Dest()
+			*dest[0].(*any) = []byte(row.bucket)
+			*dest[1].(*int64) = row.orders
+			*dest[2].(*sql.NullFloat64) = sql.NullFloat64{Float64: row.revenue, Valid: true}
+			require.NoError(t, query.Collect())
+		}
+
+		points := query.Points()
+		require.Len(t, points, 4)
+		assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, moscow), points[0].Time)
+		assert.Equal(t, Aggregates{"orders": int64(2), "revenue": 100.0}, points[0].Values)
+		assert.Equal(t, time.Date(2024, 3, 2, 0, 0, 0, 0, moscow), points[1].Time)
+		assert.Equal(t, Aggregates{"orders": int64(0), "revenue": nil}, points[1].Values)
+		assert.Equal(t, time.Date(2024, 3, 4, 0, 0, 0, 0, moscow), points[3].Time)
+	})
+
+	t.Run("unknown bucket", func(t *testing.T) {
+		_, err := b.BuildTimeSeries("created", "decade", aggregates, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestEnumSortAndPins(t *testing.T) {
+	b := NewSQLBuilder().
+		WithFrom("tickets").
+		WithFields("id", "priority").
+		WithTieBreaker("id").
+		WithFieldConfig("priority", "priority", EQ, SortOrder("critical", "high", "normal", "low")).
+		WithFieldConfig("status", "status", EQ).
+		ApplyFilter("status", "open")
+
+	t.Run("enum order", func(t *testing.T) {
+		sql, args, err := b.Sort("priority", "ASC").BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT id, priority FROM tickets WHERE (status = $1) "+
+			"ORDER BY CASE priority WHEN $2 THEN 0 WHEN $3 THEN 1 WHEN $4 THEN 2 WHEN $5 THEN 3 ELSE 4 END ASC, id ASC LIMIT 7", sql)
+		assert.Equal(t, []any{"open", "critical", "high", "normal", "low"}, args)
+	})
+
+	t.Run("pinned column", func(t *testing.T) {
+		sql, _, err := b.PinFirst("pinned").Sort("id", "DESC").BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT id, priority FROM tickets WHERE (status = $1) "+
+			"ORDER BY CASE WHEN pinned THEN 0 ELSE 1 END ASC, id DESC, id ASC LIMIT 7", sql)
+	})
+
+	t.Run("keyset over synthetic keys", func(t *testing.T) {
+		sql, args, err := NewSQLBuilder().
+			WithPlaceholder(squirrel.Question).
+			WithFrom("tickets").
+			WithFields("id").
+			WithTieBreaker("id").
+			WithFieldConfig("priority", "priority", EQ, SortOrder("critical", "high")).
+			PinIDs("id", 5, 9).
+			Sort("priority", "DESC").
+			After(map[string]any{"id": 9, "priority": "high"}).
+			Limit(10).
+			BuildSelect()
+		require.NoError(t, err)
+
+		pin := "CASE WHEN id IN (?,?) THEN 0 ELSE 1 END"
+		enum := "CASE priority WHEN ? THEN 0 WHEN ? THEN 1 ELSE 2 END"
+		expected := "SELECT id FROM tickets WHERE (" +
+			"(" + pin + " > ?) OR " +
+			"(" + pin + " = ? AND " + enum + " < ?) OR " +
+			"(" + pin + " = ? AND " + enum + " = ? AND id > ?)) " +
+			"ORDER BY " + pin + " ASC, " + enum + " DESC, id ASC LIMIT 10"
+		assert.Equal(t, expected, sql)
+		assert.Equal(t, []any{
+			5, 9, 0,
+			5, 9, 0, "critical", "high", 1,
+			5, 9, 0, "critical", "high", 1, 9,
+			5, 9, "critical", "high",
+		}, args)
+	})
+
+	t.Run("cursor errors", func(t *testing.T) {
+		_, _, err := b.Reset().Sort("priority", "ASC").After(map[string]any{"priority": "low"}).BuildSelect()
+		assert.ErrorContains(t, err, `cursor has no value for "id"`)
+
+		_, _, err = NewSQLBuilder().WithFrom("tickets").After(map[string]any{}).BuildSelect()
+		assert.Error(t, err)
+	})
+}
+
+func TestRelatedAggregateSort(t *testing.T) {
+	b := NewSQLBuilder().
+		WithFrom("customers c").
+		WithFields("c.id", "c.name").
+		WithEstimate("customers").
+		WithRelation("orders", "orders o", "o.customer_id = c.id").
+		WithLazyLeftJoin("stats", "customer_stats s", "s.customer_id = c.id").
+		WithSortField("orders_count", "COUNT(*)", Relation("orders")).
+		WithSortField("last_order", "MAX(o.created_at)", Relation("orders")).
+		WithSortField("rating", "s.rating", Joins("stats")).
+		WithFieldConfig("name", "c.name", ILIKE)
+	require.NoError(t, b.Validate())
+
+	t.Run("correlated subquery", func(t *testing.T) {
+		b.ApplyFilter("name", "ann").Sort("last_order", "DESC")
+
+		sql, args, err := b.BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT c.id, c.name FROM customers c WHERE (c.name ILIKE $1) "+
+			"ORDER BY (SELECT MAX(o.created_at) FROM orders o WHERE o.customer_id = c.id) DESC LIMIT 7", sql)
+		assert.Equal(t, []any{"%ann%"}, args)
+
+		sql, _, err = b.BuildCount()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT COUNT(*) FROM (SELECT 1 FROM customers c WHERE (c.name ILIKE $1)) AS subquery", sql)
+	})
+
+	t.Run("lazy join only for active sort", func(t *testing.T) {
+		sql, _, err := b.Reset().Sort("rating", "DESC").BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT c.id, c.name FROM customers c LEFT JOIN customer_stats s ON s.customer_id = c.id ORDER BY s.rating DESC", sql)
+
+		sql, _, err = b.Reset().Sort("orders_count", "ASC").BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT c.id, c.name FROM customers c ORDER BY (SELECT COUNT(*) FROM orders o WHERE o.customer_id = c.id) ASC", sql)
+
+		sql, _, err = b.Reset().Sort("rating", "DESC").BuildCount()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT reltuples::bigint AS estimate FROM pg_class WHERE oid = $1::regclass", sql)
+	})
+
+	t.Run("unknown relation", func(t *testing.T) {
+		invalid := NewSQLBuilder().WithFrom("customers c").WithSortField("orders_count", "COUNT(*)", Relation("orders"))
+		assert.Error(t, invalid.Validate())
+
+		_, _, err := invalid.Sort("orders_count", "DESC").BuildSelect()
+		assert.ErrorContains(t, err, `unknown relation "orders"`)
+	})
+}
+
+func TestRandomSort(t *testing.T) {
+	t.Run("postgres", func(t *testing.T) {
+		sql, args, err := NewSQLBuilder().
+			WithDialect(PostgreSQL).
+			WithFrom("products").
+			WithFields("id").
+			WithFieldConfig("category", "category", EQ).
+			ApplyFilter("category", "books").
+			SortRandom("id", "s1").
+			Page(3, 20).
+			BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT id FROM products WHERE (category = $1) ORDER BY md5(id::text || $2) ASC LIMIT 20 OFFSET 40", sql)
+		assert.Equal(t, []any{"books", "s1"}, args)
+	})
+
+	t.Run("mysql keyset", func(t *testing.T) {
+		sql, args, err := NewSQLBuilder().
+			WithDialect(MySQL).
+			WithFrom("products").
+			WithFields("id").
+			WithFieldConfig("category", "category", EQ).
+			ApplyFilter("category", "books").
+			SortRandom("id", "s1").
+			After(map[string]any{"id": 42}).
+			BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT id FROM products WHERE (category = ?) AND ((MD5(CONCAT(id, ?)) > ?)) ORDER BY MD5(CONCAT(id, ?)) ASC LIMIT 7", sql)
+		assert.Equal(t, []any{"books", "s1", md5Hex("42s1"), "s1"}, args)
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithDialect(SQLite).
+			WithFrom("products").
+			WithFields("id").
+			WithFieldConfig("category", "category", EQ).
+			ApplyFilter("category", "books").
+			SortRandom("id", "s1")
+		sql, args, err := b.BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT id FROM products WHERE (category = ?) ORDER BY (id % 2147483647 * ? + ?) % 2147483647 ASC LIMIT 7", sql)
+
+		a, c := randomCoefficients("s1")
+		assert.Equal(t, []any{"books", a, c}, args)
+		assert.Equal(t, (7*a+c)%randomModulus, b.sort.key(7))
+	})
+
+	t.Run("seed changes order", func(t *testing.T) {
+		a1, c1 := randomCoefficients("s1")
+		a2, c2 := randomCoefficients("s2")
+		assert.NotEqual(t, [2]int64{a1, c1}, [2]int64{a2, c2})
+		assert.NotEqual(t, md5Hex("1s1"), md5Hex("1s2"))
+	})
+}
+
+func TestLateralJoins(t *testing.T) {
+	latestComment := sq.Select("c.text", "c.created_at").
+		From("comments c").
+		Where("c.post_id = p.id AND c.status = ?", "approved").
+		OrderBy("c.created_at DESC").
+		Limit(1).
+		PlaceholderFormat(sq.Dollar)
+
+	b := NewSQLBuilder().
+		WithFrom("posts p").
+		WithFields("p.id").
+		WithInnerJoin("blogs b", "b.id = p.blog_id AND b.lang = ?", "ru").
+		WithLazyLateralJoin("latest", "LEFT JOIN", latestComment, "lc").
+		WithSelectField("title", "p.title").
+		WithSelectField("last_comment", "lc.text", Joins("latest")).
+		WithFieldConfig("author", "p.author_id", EQ, FieldType(TypeInt)).
+		WithFieldConfig("commented", "lc.created_at", GTE, FieldType(TypeTime), Joins("latest"))
+	require.NoError(t, b.Validate())
+
+	t.Run("arguments in order", func(t *testing.T) {
+		b.ApplyFilter("author", "5")
+
+		sql, args, err := b.BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT p.id, p.title AS title, lc.text AS last_comment FROM posts p "+
+			"JOIN blogs b ON b.id = p.blog_id AND b.lang = $1 "+
+			"LEFT JOIN LATERAL (SELECT c.text, c.created_at FROM comments c WHERE c.post_id = p.id AND c.status = $2 ORDER BY c.created_at DESC LIMIT 1) lc ON true "+
+			"WHERE (p.author_id = $3) LIMIT 7", sql)
+		assert.Equal(t, []any{"ru", "approved", int64(5)}, args)
+	})
+
+	t.Run("lazy inclusion", func(t *testing.T) {
+		sql, args, err := b.Reset().ApplyFields([]string{"title"}).ApplyFilter("author", "5").BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT p.id, p.title AS title FROM posts p JOIN blogs b ON b.id = p.blog_id AND b.lang = $1 WHERE (p.author_id = $2)", sql)
+		assert.Equal(t, []any{"ru", int64(5)}, args)
+
+		sql, args, err = b.Reset().ApplyFilter("commented", "2024-01-01").BuildCount()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT COUNT(*) FROM (SELECT 1 FROM posts p "+
+			"JOIN blogs b ON b.id = p.blog_id AND b.lang = $1 "+
+			"LEFT JOIN LATERAL (SELECT c.text, c.created_at FROM comments c WHERE c.post_id = p.id AND c.status = $2 ORDER BY c.created_at DESC LIMIT 1) lc ON true "+
+			"WHERE (lc.created_at >= $3)) AS subquery", sql)
+		assert.Len(t, args, 3)
+	})
+
+	t.Run("duplicate name", func(t *testing.T) {
+		duplicate := b.Clone().WithLazyLateralJoin("latest", "LEFT JOIN", latestComment, "lc2")
+		assert.ErrorContains(t, duplicate.Err(), `join "latest" is already configured`)
+	})
+}
+
+func TestSubqueryComposition(t *testing.T) {
+	paidOrders := func() *SQLBuilder {
+		return NewSQLBuilder().
+			WithFrom("orders").
+			WithFields("customer_id").
+			WithFieldConfig("status", "status", EQ).
+			WithFieldConfig("total", "total", GTE, FieldType(TypeInt)).
+			ApplyFilter("status", "paid").
+			ApplyFilter("total", "100")
+	}
+
+	t.Run("sqlizer", func(t *testing.T) {
+		var _ sq.Sqlizer = (*SQLBuilder)(nil)
+
+		sql, args, err := paidOrders().Sort("customer_id", "ASC").Limit(5).ToSql()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT customer_id FROM orders WHERE (status = ? AND total >= ?) ORDER BY customer_id ASC LIMIT 5", sql)
+		assert.Equal(t, []any{"paid", int64(100)}, args)
+
+		sql, args, err = sq.Select("*").
+			FromSelect(sq.Select("x").Where(sq.Expr("x IN (?)", paidOrders())), "t").
+			Where("y = ?", 1).
+			PlaceholderFormat(sq.Dollar).
+			ToSql()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT * FROM (SELECT x WHERE x IN (SELECT customer_id FROM orders WHERE (status = $1 AND total >= $2) LIMIT 7)) AS t WHERE y = $3", sql)
+		assert.Equal(t, []any{"paid", int64(100), 1}, args)
+	})
+
+	t.Run("in subquery", func(t *testing.T) {
+		sql, args, err := NewSQLBuilder().
+			WithFrom("customers c").
+			WithFields("c.id").
+			WithFieldConfig("id", "c.id", EQ).
+			WithFieldConfig("country", "c.country", EQ).
+			ApplyFilter("country", "DE").
+			InSubquery("id", paidOrders()).
+			Eq("c.active", true).
+			BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT c.id FROM customers c WHERE (c.country = $1 AND "+
+			"c.id IN (SELECT customer_id FROM orders WHERE (status = $2 AND total >= $3)) AND c.active = $4) LIMIT 7", sql)
+		assert.Equal(t, []any{"DE", "paid", int64(100), true}, args)
+	})
+
+	t.Run("from subquery", func(t *testing.T) {
+		b := NewSQLBuilder().
+			WithFromSubquery(paidOrders(), "po").
+			WithFields("po.customer_id").
+			WithFieldConfig("customer", "po.customer_id", GT, FieldType(TypeInt)).
+			ApplyFilter("customer", "10")
+		require.NoError(t, b.Validate())
+
+		sql, args, err := b.BuildSelect()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT po.customer_id FROM (SELECT customer_id FROM orders WHERE (status = $1 AND total >= $2)) AS po "+
+			"WHERE (po.customer_id > $3) LIMIT 7", sql)
+		assert.Equal(t, []any{"paid", int64(100), int64(10)}, args)
+
+		sql, _, err = b.BuildCount()
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT COUNT(*) FROM (SELECT 1 FROM (SELECT customer_id FROM orders WHERE (status = $1 AND total >= $2)) AS po "+
+			"WHERE (po.customer_id > $3)) AS subquery", sql)
+	})
+
+	t.Run("outer request context", func(t *testing.T) {
+		type tenantKey struct{}
+		tenantOrders := func() *SQLBuilder {
+			return NewSQLBuilderWithContext(context.WithValue(context.Background(), tenantKey{}, 1)).
+				WithFrom("orders").
+				WithFields("customer_id").
+				WithRequiredScope("tenant", ContextScope("tenant_id", tenantKey{}))
+		}
+
+		def, err := NewListDefinition(NewSQLBuilder().
+			WithFromSubquery(tenantOrders(), "po").
+			WithFields("po.customer_id"))
+		require.NoError(t, err)
+
+		first := def.NewRequestWithContext(context.WithValue(context.Background(), tenantKey{}, 1))
+		second := def.NewRequestWithContext(context.WithValue(context.Background(), tenantKey{}, 2))
+		assert.NotSame(t, first.fromSubquery, second.fromSubquery)
+
+		for tenant, b := range map[int]*SQLBuilder{1: first, 2: second} {
+			sql, args, err := b.BuildSelect()
+			require.NoError(t, err)
+			assert.Equal(t, "SELECT po.customer_id FROM (SELECT customer_id FROM orders WHERE (tenant_id = $1)) AS po LIMIT 7", sql)
+			assert.Equal(t, []any{tenant}, args)
+
+			sql, args, err = NewSQLBuilderWithContext(b.Context()).
+				WithFrom("customers c").
+				WithFields("c.id").
+				InSubquery("c.id", tenantOrders()).
+				BuildSelect()
+			require.NoError(t, err)
+			assert.Equal(t, "SELECT c.id FROM customers c WHERE (c.id IN (SELECT customer_id FROM orders WHERE (tenant_id = $1))) LIMIT 7", sql)
+			assert.Equal(t, []any{tenant}, args)
+		}
+
+		_, _, err = def.NewRequest().BuildSelect()
+		assert.ErrorIs(t, err, ErrScopeNotSatisfied)
+	})
+
+	t.Run("inner errors", func(t *testing.T) {
+		inner := paidOrders().ApplyFilter("total", "abc")
+
+		_, _, err := NewSQLBuilder().WithFrom("customers").InSubquery("id", inner).BuildSelect()
+		assert.Error(t, err)
+
+		_, _, err = NewSQLBuilder().WithFromSubquery(inner, "po").BuildSelect()
+		assert.Error(t, err)
+	})
 }
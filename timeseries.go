@@ -0,0 +1,277 @@
+package sqlist
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// Bucket интервал группировки временного ряда
+type Bucket string
+
+const (
+	BucketHour  Bucket = "hour"
+	BucketDay   Bucket = "day"
+	BucketWeek  Bucket = "week" // неделя с понедельника
+	BucketMonth Bucket = "month"
+	BucketYear  Bucket = "year"
+)
+
+// TimeSeriesQuery запрос временного ряда. Колонки результата: bucket, затем алиасы Aliases
+type TimeSeriesQuery struct {
+	Bucket  Bucket
+	Aliases []string
+	SQL     string
+	Args    []any
+
+	location *time.Location
+	filled   bool // пропуски заполнены в SQL (generate_series)
+	funcs    map[string]AggFunc
+	time     any
+	values   map[string]any
+	points   []TimePoint
+}
+
+// TimePoint точка временного ряда: начало интервала и значения агрегатов
+type TimePoint struct {
+	Time   time.Time
+	Values Aggregates
+}
+
+// BuildTimeSeries строит запрос агрегатов по интервалам bucket поля timeField с учетом всех фильтров.
+// Интервалы считаются в часовом поясе tz (nil - часовой пояс билдера, см. WithLocation).
+// На PostgreSQL пустые интервалы между первым и последним заполняются generate_series,
+// для остальных диалектов их заполняет TimeSeriesQuery.Points
+func (b *SQLBuilder) BuildTimeSeries(timeField string, bucket Bucket, aggregates map[string]AggFunc, tz *time.Location) (*TimeSeriesQuery, error) {
+	if err := b.Err(); err != nil {
+		return nil, err
+	}
+	if err := b.requireUngrouped("BuildTimeSeries"); err != nil {
+		return nil, err
+	}
+	if len(aggregates) == 0 {
+		return nil, fmt.Errorf("sqlist: no aggregates")
+	}
+	if !slices.Contains([]Bucket{BucketHour, BucketDay, BucketWeek, BucketMonth, BucketYear}, bucket) {
+		return nil, fmt.Errorf("sqlist: unknown time bucket %q", bucket)
+	}
+	if tz == nil {
+		tz = b.loc()
+	}
+
+	aliases, columns, required, err := b.aggregateColumns(aggregates)
+	if err != nil {
+		return nil, err
+	}
+
+	column := timeField
+	if cfg, ok := b.fieldConfigs[timeField]; ok {
+		if missing, ok := b.missingPermission(cfg.Permissions); ok {
+			return nil, &PermissionError{Field: timeField, Permission: missing}
+		}
+		column = cfg.DBField
+		for _, name := range cfg.Joins {
+			required[name] = true
+		}
+	}
+
+	selectBuilder, err := b.filteredSelect(nil, required)
+	if err != nil {
+		return nil, err
+	}
+
+	expr, args := b.bucketExpr(column, bucket, tz)
+	selectBuilder = selectBuilder.
+		Column(sq.Expr(expr+" AS bucket", args...)).
+		Columns(columns...).
+		GroupBy("1")
+
+	query := &TimeSeriesQuery{
+		Bucket:   bucket,
+		Aliases:  aliases,
+		location: tz,
+		funcs:    maps.Clone(aggregates),
+	}
+
+	if b.dialect == PostgreSQL {
+		query.SQL, query.Args, err = seriesWithGaps(selectBuilder, bucket, aliases, aggregates).
+			PlaceholderFormat(b.placeholder).
+			ToSql()
+		query.filled = true
+	} else {
+		query.SQL, query.Args, err = selectBuilder.
+			OrderBy("bucket").
+			PlaceholderFormat(b.placeholder).
+			ToSql()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return query, nil
+}
+
+// bucketExpr строит выражение начала интервала в часовом поясе tz.
+// Для time.Local значения не переводятся: используется часовой пояс сессии БД
+func (b *SQLBuilder) bucketExpr(column string, bucket Bucket, tz *time.Location) (string, []any) {
+	local := tz == time.Local
+
+	switch b.dialect {
+	case MySQL:
+		// значения хранятся в UTC, именованные пояса требуют загруженных таблиц часовых поясов
+		value, args := column, []any(nil)
+		if !local {
+			value, args = "CONVERT_TZ("+column+", '+00:00', ?)", []any{tz.String()}
+		}
+
+		switch bucket {
+		case BucketHour:
+			return "DATE_FORMAT(" + value + ", '%Y-%m-%d %H:00:00')", args
+		case BucketDay:
+			return "DATE(" + value + ")", args
+		case BucketWeek:
+			return "DATE(" + value + ") - INTERVAL WEEKDAY(" + value + ") DAY", append(args, args...)
+		case BucketMonth:
+			return "DATE_FORMAT(" + value + ", '%Y-%m-01')", args
+		default:
+			return "DATE_FORMAT(" + value + ", '%Y-01-01')", args
+		}
+
+	case SQLite:
+		// в SQLite нет именованных поясов: используется смещение пояса на текущий момент
+		modifier := "localtime"
+		if !local {
+			_, offset := b.now().In(tz).Zone()
+			modifier = fmt.Sprintf("%+d minutes", offset/60)
+		}
+		args := []any{modifier}
+
+		switch bucket {
+		case BucketHour:
+			return "strftime('%Y-%m-%d %H:00:00', " + column + ", ?)", args
+		case BucketDay:
+			return "date(" + column + ", ?)", args
+		case BucketWeek:
+			return "date(" + column + ", ?, 'weekday 0', '-6 days')", args
+		case BucketMonth:
+			return "strftime('%Y-%m-01', " + column + ", ?)", args
+		default:
+			return "strftime('%Y-01-01', " + column + ", ?)", args
+		}
+	}
+
+	if local {
+		return "date_trunc('" + string(bucket) + "', " + column + ")", nil
+	}
+	return "date_trunc('" + string(bucket) + "', " + column + " AT TIME ZONE ?)", []any{tz.String()}
+}
+
+// seriesWithGaps дополняет ряд пустыми интервалами между первым и последним через generate_series
+func seriesWithGaps(series sq.SelectBuilder, bucket Bucket, aliases []string, aggregates map[string]AggFunc) sq.SelectBuilder {
+	columns := []string{"g.bucket AS bucket"}
+	for _, alias := range aliases {
+		if aggregates[alias].Func == "COUNT" {
+			columns = append(columns, "COALESCE(series."+alias+", 0) AS "+alias)
+		} else {
+			columns = append(columns, "series."+alias)
+		}
+	}
+
+	return sq.Select(columns...).
+		Prefix("WITH series AS (?)", series).
+		From("generate_series((SELECT MIN(bucket) FROM series), (SELECT MAX(bucket) FROM series), " +
+			"'1 " + string(bucket) + "'::interval) AS g(bucket)").
+		LeftJoin("series ON series.bucket = g.bucket").
+		OrderBy("g.bucket")
+}
+
+// Dest возвращает приемники для rows.Scan строки результата
+func (q *TimeSeriesQuery) Dest() []any {
+	var dest []any
+	dest, q.values = aggregateDest(q.Aliases, q.funcs)
+	q.time = nil
+	return append([]any{&q.time}, dest...)
+}
+
+// Collect добавляет в ряд строку, отсканированную в приемники Dest
+func (q *TimeSeriesQuery) Collect() error {
+	t, err := q.bucketTime(q.time)
+	if err != nil {
+		return err
+	}
+	q.points = append(q.points, TimePoint{Time: t, Values: aggregateResult(q.values)})
+	return nil
+}
+
+// Points возвращает точки ряда по возрастанию времени без пропусков:
+// в пустых интервалах COUNT равен 0, остальные агрегаты nil
+func (q *TimeSeriesQuery) Points() []TimePoint {
+	if q.filled || len(q.points) == 0 {
+		return q.points
+	}
+
+	points := make([]TimePoint, 0, len(q.points))
+	for _, point := range q.points {
+		if len(points) > 0 {
+			for t := q.next(points[len(points)-1].Time); t.Before(point.Time); t = q.next(t) {
+				points = append(points, TimePoint{Time: t, Values: q.empty()})
+			}
+		}
+		points = append(points, point)
+	}
+	return points
+}
+
+// next возвращает начало следующего интервала
+func (q *TimeSeriesQuery) next(t time.Time) time.Time {
+	switch q.Bucket {
+	case BucketHour:
+		return t.Add(time.Hour)
+	case BucketDay:
+		return t.AddDate(0, 0, 1)
+	case BucketWeek:
+		return t.AddDate(0, 0, 7)
+	case BucketMonth:
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(1, 0, 0)
+	}
+}
+
+// empty возвращает значения агрегатов пустого интервала
+func (q *TimeSeriesQuery) empty() Aggregates {
+	values := make(Aggregates, len(q.Aliases))
+	for _, alias := range q.Aliases {
+		if q.funcs[alias].Func == "COUNT" {
+			values[alias] = int64(0)
+		} else {
+			values[alias] = nil
+		}
+	}
+	return values
+}
+
+// bucketTime приводит начало интервала из результата к времени в часовом поясе ряда
+func (q *TimeSeriesQuery) bucketTime(value any) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		// timestamp без пояса драйверы возвращают в UTC с локальным временем интервала
+		if v.Location() == time.UTC && q.location != time.UTC {
+			return time.Date(v.Year(), v.Month(), v.Day(), v.Hour(), v.Minute(), v.Second(), v.Nanosecond(), q.location), nil
+		}
+		return v.In(q.location), nil
+	case []byte:
+		return q.bucketTime(string(v))
+	case string:
+		for _, layout := range timeLayouts {
+			if t, err := time.ParseInLocation(layout, v, q.location); err == nil {
+				return t, nil
+			}
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("sqlist: invalid time bucket %v", value)
+}
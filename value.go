@@ -0,0 +1,132 @@
+package sqlist
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// ValueType тип значения поля. Значения фильтров приводятся к нему перед передачей в запрос
+type ValueType string
+
+const (
+	TypeString ValueType = ""      // строка как есть (по умолчанию)
+	TypeInt    ValueType = "int"   // int64
+	TypeFloat  ValueType = "float" // float64
+	TypeBool   ValueType = "bool"  // true/false, 1/0
+	TypeTime   ValueType = "time"  // RFC3339, "2006-01-02 15:04:05" или дата "2006-01-02"
+)
+
+// форматы, в которых принимается значение типа TypeTime
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	time.DateOnly,
+}
+
+// FieldOption дополнительная настройка поля
+type FieldOption func(*FieldConfig)
+
+// FieldType задает тип значения поля
+func FieldType(valueType ValueType) FieldOption {
+	return func(cfg *FieldConfig) {
+		cfg.Type = valueType
+	}
+}
+
+// Nullable разрешает фильтровать поле по NULL значениями-маркерами (см. WithNullTokens)
+func Nullable() FieldOption {
+	return func(cfg *FieldConfig) {
+		cfg.Nullable = true
+	}
+}
+
+// parseValue приводит строковое значение к типу поля
+func (b *SQLBuilder) parseValue(cfg FieldConfig, value string) (interface{}, error) {
+	switch cfg.Type {
+	case TypeString:
+		return value, nil
+	case TypeInt:
+		return strconv.ParseInt(value, 10, 64)
+	case TypeFloat:
+		return strconv.ParseFloat(value, 64)
+	case TypeBool:
+		return strconv.ParseBool(value)
+	case TypeTime:
+		t, err := b.parseTime(value)
+		if err != nil {
+			return nil, err
+		}
+		return t.start, nil
+	}
+
+	return nil, fmt.Errorf("sqlist: unknown value type %q", cfg.Type)
+}
+
+// comparison строит условие сравнения колонки со значением, приведенным к типу поля.
+// Даты сравниваются с учетом интервалов (см. timeCondition)
+func (b *SQLBuilder) comparison(column string, cfg FieldConfig, op Op, value string) (sq.Sqlizer, error) {
+	if cfg.Type == TypeTime {
+		t, err := b.parseTime(value)
+		if err != nil {
+			return nil, err
+		}
+		return timeCondition(column, op, t), nil
+	}
+
+	parsed, err := b.parseValue(cfg, value)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case EQ:
+		return sq.Eq{column: parsed}, nil
+	case NOT_EQ:
+		return sq.NotEq{column: parsed}, nil
+	case GT:
+		return sq.Gt{column: parsed}, nil
+	case GTE:
+		return sq.GtOrEq{column: parsed}, nil
+	case LT:
+		return sq.Lt{column: parsed}, nil
+	case LTE:
+		return sq.LtOrEq{column: parsed}, nil
+	}
+
+	return nil, fmt.Errorf("sqlist: operator %q is not a comparison", op)
+}
+
+// parseValues приводит список значений к типизированному срезу ([]int64, []time.Time, ...),
+// чтобы драйвер мог передать его как параметр-массив
+func (b *SQLBuilder) parseValues(cfg FieldConfig, values []string) (interface{}, error) {
+	switch cfg.Type {
+	case TypeString:
+		return values, nil
+	case TypeInt:
+		return parseSlice[int64](b, cfg, values)
+	case TypeFloat:
+		return parseSlice[float64](b, cfg, values)
+	case TypeBool:
+		return parseSlice[bool](b, cfg, values)
+	case TypeTime:
+		return parseSlice[time.Time](b, cfg, values)
+	}
+
+	return nil, fmt.Errorf("sqlist: unknown value type %q", cfg.Type)
+}
+
+func parseSlice[T any](b *SQLBuilder, cfg FieldConfig, values []string) ([]T, error) {
+	result := make([]T, 0, len(values))
+	for _, value := range values {
+		parsed, err := b.parseValue(cfg, value)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, parsed.(T))
+	}
+	return result, nil
+}